@@ -0,0 +1,273 @@
+// Command grange queries a directory of cluster files from the command line.
+//
+//	grange [flags] query [-o lines|compress|json] EXPR
+//	grange [flags] compress [-strategy domain|level|shortest] < hosts
+//	grange [flags] validate
+//	grange [flags] explain EXPR
+//	grange [flags] repl [-strategy domain|level|shortest]
+//
+// The directory contains one YAML or JSON file per cluster, see
+// grange.LoadDir for the format. It defaults to $GRANGE_DIR, or the current
+// directory if that is not set.
+//
+// grange exits with status 1 if a query cannot be parsed or evaluated, or if
+// validate finds any errors, and with status 2 on usage errors.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/xaviershay/grange"
+	"vbom.ml/util/sortorder"
+)
+
+const usage = `Usage: grange [flags] COMMAND [ARGS]
+
+Commands:
+  query EXPR   print the result of a query
+  compress     compress values read from stdin, one per line
+  validate     report errors in cluster values
+  explain EXPR show how a query is parsed
+  repl         query interactively, with tab completion and history
+
+Flags:
+`
+
+var strategies = map[string]grange.CompressStrategy{
+	"domain":   grange.DomainStrategy,
+	"level":    grange.LevelStrategy,
+	"shortest": grange.ShortestStrategy,
+}
+
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	dir             string
+	defaultCluster  string
+	caseInsensitive bool
+	unicode         bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	dir := os.Getenv("GRANGE_DIR")
+	if dir == "" {
+		dir = "."
+	}
+
+	flags := flag.NewFlagSet("grange", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.dir, "dir", dir, "directory of cluster files")
+	flags.StringVar(&c.defaultCluster, "default-cluster", grange.DefaultCluster,
+		"cluster used by @ and ? syntax")
+	flags.BoolVar(&c.caseInsensitive, "i", false, "ignore case")
+	flags.BoolVar(&c.unicode, "unicode", false, "allow unicode letters in identifiers")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "query":
+		return c.query(args[1:])
+	case "compress":
+		return c.compress(args[1:])
+	case "validate":
+		return c.validate(args[1:])
+	case "explain":
+		return c.explain(args[1:])
+	case "repl":
+		return c.repl(args[1:])
+	default:
+		fmt.Fprintf(stderr, "Unknown command: %s\n", args[0])
+		flags.Usage()
+		return 2
+	}
+}
+
+func (c *cli) query(args []string) int {
+	flags := c.flagSet("query EXPR")
+	format := flags.String("o", "lines", "output format: lines, compress or json")
+	strategy := c.strategyFlag(flags)
+	if flags.Parse(args) != nil || flags.NArg() == 0 {
+		return c.usage(flags)
+	}
+
+	state, err := c.loadState()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	result, err := state.Query(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return c.fail(err)
+	}
+
+	switch *format {
+	case "lines":
+		for _, value := range sorted(result) {
+			fmt.Fprintln(c.stdout, value)
+		}
+	case "compress":
+		return c.printCompressed(result, *strategy)
+	case "json":
+		out, _ := json.Marshal(sorted(result))
+		fmt.Fprintln(c.stdout, string(out))
+	default:
+		fmt.Fprintf(c.stderr, "Unknown output format: %s\n", *format)
+		return 2
+	}
+	return 0
+}
+
+func (c *cli) compress(args []string) int {
+	flags := c.flagSet("compress < values")
+	strategy := c.strategyFlag(flags)
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return c.usage(flags)
+	}
+
+	result := grange.NewResult()
+	scanner := bufio.NewScanner(c.stdin)
+	for scanner.Scan() {
+		if value := strings.TrimSpace(scanner.Text()); value != "" {
+			result.Add(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return c.fail(err)
+	}
+
+	return c.printCompressed(result, *strategy)
+}
+
+func (c *cli) validate(args []string) int {
+	flags := c.flagSet("validate")
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return c.usage(flags)
+	}
+
+	state, err := c.loadState()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	messages := []string{}
+	for _, err := range state.PrimeCache() {
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+
+	for _, message := range messages {
+		fmt.Fprintf(c.stderr, "grange: %s\n", message)
+	}
+	if len(messages) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) explain(args []string) int {
+	flags := c.flagSet("explain EXPR")
+	if flags.Parse(args) != nil || flags.NArg() == 0 {
+		return c.usage(flags)
+	}
+
+	// Parsing does not depend on clusters, so there is no need to load any.
+	state := c.newState()
+	explanation, err := state.Explain(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return c.fail(err)
+	}
+
+	fmt.Fprintln(c.stdout, explanation)
+	return 0
+}
+
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
+
+func (c *cli) strategyFlag(flags *flag.FlagSet) *string {
+	return flags.String("strategy", "domain", "compress strategy: domain, level or shortest")
+}
+
+func (c *cli) usage(flags *flag.FlagSet) int {
+	fmt.Fprintf(c.stderr, "Usage: grange %s\n", flags.Name())
+	flags.PrintDefaults()
+	return 2
+}
+
+func (c *cli) fail(err error) int {
+	fmt.Fprintf(c.stderr, "grange: %s\n", err)
+	return 1
+}
+
+func (c *cli) newState() grange.State {
+	state := grange.NewState()
+	c.configure(&state)
+	return state
+}
+
+func (c *cli) loadState() (grange.State, error) {
+	state, err := grange.LoadDir(c.dir)
+	c.configure(&state)
+	return state, err
+}
+
+func (c *cli) configure(state *grange.State) {
+	state.SetDefaultCluster(c.defaultCluster)
+	state.SetCaseInsensitive(c.caseInsensitive)
+	state.SetUnicodeIdentifiers(c.unicode)
+}
+
+func (c *cli) printCompressed(result grange.Result, name string) int {
+	strategy, ok := strategies[name]
+	if !ok {
+		fmt.Fprintf(c.stderr, "Unknown compress strategy: %s\n", name)
+		return 2
+	}
+
+	compressed, err := grange.CompressWith(&result, strategy)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	fmt.Fprintln(c.stdout, compressed)
+	return 0
+}
+
+func sorted(result grange.Result) []string {
+	values := []string{}
+	for value := range result.Iter() {
+		values = append(values, value.(string))
+	}
+	sort.Sort(sortorder.Natural(values))
+	return values
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"dc1.yaml": "CLUSTER: [web1, web2, web3]\nDOWN: web2\n",
+		"dc2.json": `{"CLUSTER": ["db1"], "BAD": "%dc1 -"}`,
+		"README":   "not a cluster",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testRun(t *testing.T, expectedCode int, expected string, stdin string, args ...string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	if code != expectedCode {
+		t.Errorf("%v exited %d, want %d. stderr:\n%s", args, code, expectedCode, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Errorf("%v\n got: %s\nwant: %s", args, stdout.String(), expected)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	testRun(t, 0, "web1\nweb3\n", "", "-dir", dir, "query", "%dc1 - %dc1:DOWN")
+	testRun(t, 0, "web1\nweb3\n", "", "-dir", dir, "query", "%dc1", "-", "%dc1:DOWN")
+	testRun(t, 0, "db1,web1..3\n", "", "-dir", dir, "query", "-o", "compress", "%dc1,%dc2")
+	testRun(t, 0, `["db1","web1"]`+"\n", "", "-dir", dir, "query", "-o", "json", "%dc2,web1")
+	testRun(t, 0, "web1\n", "", "-dir", dir, "-i", "query", "%DC1 & WEB1")
+	testRun(t, 1, "", "", "-dir", dir, "query", "%dc1 -")
+	testRun(t, 1, "", "", "-dir", dir, "query", "%dc2:BAD")
+	testRun(t, 2, "", "", "-dir", dir, "query", "-o", "xml", "%dc1")
+	testRun(t, 2, "", "", "-dir", dir, "query")
+}
+
+func TestCompress(t *testing.T) {
+	testRun(t, 0, "a,web1..2\n", "web2\n\nweb1\n a \n", "compress")
+	testRun(t, 0, "web1.dc1..2\n", "web1.dc1\nweb1.dc2\n", "compress", "-strategy", "level")
+	testRun(t, 2, "", "", "compress", "-strategy", "best")
+}
+
+func TestValidate(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	testRun(t, 1, "", "", "-dir", dir, "validate")
+
+	os.Remove(filepath.Join(dir, "dc2.json"))
+	testRun(t, 0, "", "", "-dir", dir, "validate")
+
+	ioutil.WriteFile(filepath.Join(dir, "dc3.yaml"), []byte("CLUSTER: [a"), 0644)
+	testRun(t, 1, "", "", "-dir", dir, "validate")
+}
+
+func TestExplain(t *testing.T) {
+	testRun(t, 0, "a , b\nunion (,)\n  value a\n  value b\n", "", "explain", "a,b")
+	testRun(t, 1, "", "", "explain", "a,")
+}
+
+func TestUsage(t *testing.T) {
+	testRun(t, 2, "", "")
+	testRun(t, 2, "", "", "frobnicate")
+}
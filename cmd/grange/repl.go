@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xaviershay/grange"
+	"vbom.ml/util/sortorder"
+)
+
+const prompt = "grange> "
+
+const replHelp = `Enter a query to evaluate it, or one of:
+  :explain EXPR   show how a query is parsed
+  :compress EXPR  print the result of a query compressed
+  :history        list previous input
+  :help           show this message
+  :quit           exit, as does ctrl-d
+`
+
+var metaCommands = []string{":compress ", ":explain ", ":help", ":history", ":quit"}
+
+// clusterKeyRegexp matches a cluster lookup up to the key being typed.
+var clusterKeyRegexp = regexp.MustCompile(`%([^%:\s(){}]+):$`)
+
+type repl struct {
+	state          *grange.State
+	defaultCluster string
+	strategy       grange.CompressStrategy
+	term           terminal
+	history        []string
+
+	// Overridden in tests so that timings are predictable.
+	since func(time.Time) time.Duration
+}
+
+func (c *cli) repl(args []string) int {
+	flags := c.flagSet("repl")
+	strategy := c.strategyFlag(flags)
+	if flags.Parse(args) != nil || flags.NArg() != 0 {
+		return c.usage(flags)
+	}
+	if _, ok := strategies[*strategy]; !ok {
+		fmt.Fprintf(c.stderr, "Unknown compress strategy: %s\n", *strategy)
+		return 2
+	}
+
+	state, err := c.loadState()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	r := &repl{
+		state:          &state,
+		defaultCluster: c.defaultCluster,
+		strategy:       strategies[*strategy],
+		since:          time.Since,
+	}
+	term, restore := newTerminal(c.stdin, c.stdout, r.complete, func() []string { return r.history })
+	defer restore()
+
+	r.term = term
+	return r.run()
+}
+
+func (r *repl) run() int {
+	for {
+		line, err := r.term.ReadLine(prompt)
+		if err == io.EOF {
+			return 0
+		} else if err != nil {
+			fmt.Fprintf(r.term, "error: %s\n", err)
+			return 1
+		}
+
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if len(r.history) == 0 || r.history[len(r.history)-1] != line {
+			r.history = append(r.history, line)
+		}
+		if !r.eval(line) {
+			return 0
+		}
+	}
+}
+
+// eval runs a single line of input, returning false if the REPL should exit.
+func (r *repl) eval(line string) bool {
+	command := strings.TrimSpace(line)
+
+	switch {
+	case command == ":quit" || command == ":q":
+		return false
+	case command == ":help":
+		fmt.Fprint(r.term, replHelp)
+	case command == ":history":
+		for i, entry := range r.history {
+			fmt.Fprintf(r.term, "%4d  %s\n", i+1, entry)
+		}
+	case strings.HasPrefix(command, ":explain "):
+		offset, expr := r.argument(line, ":explain ")
+		explanation, err := r.state.Explain(expr)
+		if err != nil {
+			r.printError(err, expr, offset)
+		} else {
+			fmt.Fprintln(r.term, explanation)
+		}
+	case strings.HasPrefix(command, ":compress "):
+		offset, expr := r.argument(line, ":compress ")
+		r.query(expr, offset, true)
+	case strings.HasPrefix(command, ":"):
+		fmt.Fprintf(r.term, "Unknown command: %s, see :help\n", strings.Fields(command)[0])
+	default:
+		r.query(line, 0, false)
+	}
+	return true
+}
+
+// argument returns the argument of a meta-command, along with its offset in
+// the line in characters.
+func (r *repl) argument(line string, command string) (int, string) {
+	i := strings.Index(line, command) + len(command)
+	return utf8.RuneCountInString(line[:i]), line[i:]
+}
+
+func (r *repl) query(expr string, offset int, compress bool) {
+	start := time.Now()
+	result, err := r.state.Query(expr)
+	elapsed := r.since(start)
+
+	if err != nil {
+		r.printError(err, expr, offset)
+		return
+	}
+
+	if compress {
+		compressed, err := grange.CompressWith(&result, r.strategy)
+		if err != nil {
+			r.printError(err, expr, offset)
+			return
+		}
+		fmt.Fprintln(r.term, compressed)
+	} else {
+		for _, value := range sorted(result) {
+			fmt.Fprintln(r.term, value)
+		}
+	}
+
+	noun := "values"
+	if result.Cardinality() == 1 {
+		noun = "value"
+	}
+	fmt.Fprintf(r.term, "(%d %s in %s)\n", result.Cardinality(), noun, elapsed)
+}
+
+// printError points at the problem for syntax errors in the line that was
+// entered. Errors in cluster values are printed as is.
+func (r *repl) printError(err error, expr string, offset int) {
+	if e, ok := err.(*grange.ParseError); ok && e.Query == expr {
+		caret := utf8.RuneCountInString(prompt) + offset + e.Offset
+		fmt.Fprintf(r.term, "%s^\n", strings.Repeat(" ", caret))
+	}
+	fmt.Fprintf(r.term, "error: %s\n", err)
+}
+
+// complete offers meta-commands at the start of a line, cluster names after
+// %, keys after %cluster: and @, and functions anywhere else a word can
+// start.
+func (r *repl) complete(line string) (int, []string) {
+	if strings.HasPrefix(line, ":") && !strings.Contains(line, " ") {
+		return 0, matching(metaCommands, line)
+	}
+
+	start := len(line)
+	for start > 0 {
+		c, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isWordChar(c) {
+			break
+		}
+		start -= size
+	}
+	word := line[start:]
+	before := line[:start]
+
+	var candidates []string
+	switch {
+	case strings.HasSuffix(before, "%"):
+		for name := range r.state.Clusters() {
+			candidates = append(candidates, name)
+		}
+	case strings.HasSuffix(before, "@"):
+		candidates = r.keys(r.defaultCluster)
+	case clusterKeyRegexp.MatchString(before):
+		candidates = r.keys(clusterKeyRegexp.FindStringSubmatch(before)[1])
+	case before == "" || strings.ContainsAny(before[len(before)-1:], " ,&^-!(;{"):
+		for _, name := range grange.Functions() {
+			candidates = append(candidates, name+"(")
+		}
+	}
+
+	candidates = matching(candidates, word)
+	sort.Sort(sortorder.Natural(candidates))
+	return start, candidates
+}
+
+func (r *repl) keys(cluster string) []string {
+	if _, ok := r.state.Clusters()[cluster]; !ok {
+		return nil
+	}
+
+	result, err := r.state.Query(fmt.Sprintf("%%%s:KEYS", cluster))
+	if err != nil {
+		return nil
+	}
+	return sorted(result)
+}
+
+func matching(values []string, prefix string) []string {
+	result := []string{}
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func isWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_.-", c)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xaviershay/grange"
+)
+
+// fakeTerminal returns scripted lines and records everything written,
+// including prompts and input, like a terminal would show it.
+type fakeTerminal struct {
+	lines []string
+	bytes.Buffer
+}
+
+func (t *fakeTerminal) ReadLine(prompt string) (string, error) {
+	if len(t.lines) == 0 {
+		return "", io.EOF
+	}
+	line := t.lines[0]
+	t.lines = t.lines[1:]
+	t.WriteString(prompt + line + "\n")
+	return line, nil
+}
+
+func testRepl() *repl {
+	state := grange.NewState()
+	state.AddCluster("dc1", grange.Cluster{"CLUSTER": []string{"web1", "web2"}, "DOWN": []string{"web2"}})
+	state.AddCluster("db", grange.Cluster{"CLUSTER": []string{"%dc1 -"}})
+	state.AddCluster("GROUPS", grange.Cluster{"web": []string{"%dc1"}, "dns": []string{}})
+
+	return &repl{
+		state:          &state,
+		defaultCluster: "GROUPS",
+		strategy:       grange.DomainStrategy,
+		since:          func(time.Time) time.Duration { return 1500 * time.Microsecond },
+	}
+}
+
+func testSession(t *testing.T, expected string, lines ...string) *repl {
+	r := testRepl()
+	term := &fakeTerminal{lines: lines}
+	r.term = term
+
+	if code := r.run(); code != 0 {
+		t.Errorf("repl exited %d", code)
+	}
+	if term.String() != expected {
+		t.Errorf("Session\n got:\n%s\nwant:\n%s", term.String(), expected)
+	}
+	return r
+}
+
+func TestReplQuery(t *testing.T) {
+	testSession(t, `grange> %dc1
+web1
+web2
+(2 values in 1.5ms)
+grange> `+`
+grange> %dc1 - %dc1:DOWN
+web1
+(1 value in 1.5ms)
+`, "%dc1", "", "%dc1 - %dc1:DOWN")
+}
+
+func TestReplErrors(t *testing.T) {
+	testSession(t, `grange> %dc1 & & a
+               ^
+error: Could not parse query: %dc1 & & a
+grange> :explain a,
+                  ^
+error: Could not parse query: a,
+grange> %db
+error: Could not parse query: %dc1 -
+grange> :frob a
+Unknown command: :frob, see :help
+`, "%dc1 & & a", ":explain a,", "%db", ":frob a")
+}
+
+func TestReplMetaCommands(t *testing.T) {
+	r := testSession(t, `grange> :compress %dc1
+web1..2
+(2 values in 1.5ms)
+grange> :explain a,b
+a , b
+union (,)
+  value a
+  value b
+grange> :explain a,b
+a , b
+union (,)
+  value a
+  value b
+grange> :history
+   1  :compress %dc1
+   2  :explain a,b
+   3  :history
+grange> :quit
+`, ":compress %dc1", ":explain a,b", ":explain a,b", ":history", ":quit", "%dc1")
+
+	expected := []string{":compress %dc1", ":explain a,b", ":history", ":quit"}
+	if !reflect.DeepEqual(r.history, expected) {
+		t.Errorf("History\n got: %v\nwant: %v", r.history, expected)
+	}
+}
+
+func TestReplComplete(t *testing.T) {
+	tests := []struct {
+		line       string
+		start      int
+		candidates []string
+	}{
+		{"%d", 1, []string{"db", "dc1"}},
+		{"%dc1 - %", 8, []string{"GROUPS", "db", "dc1"}},
+		{"%dc1:D", 5, []string{"DOWN"}},
+		{"%dc1:", 5, []string{"CLUSTER", "DOWN"}},
+		{"%nope:", 6, []string{}},
+		{"@", 1, []string{"dns", "web"}},
+		{"@w", 1, []string{"web"}},
+		{"has", 0, []string{"has(", "hasall(", "hasnot("}},
+		{"%dc1 & cou", 7, []string{"count("}},
+		{"count(lo", 6, []string{"lower("}},
+		{"web", 0, []string{}},
+		{":ex", 0, []string{":explain "}},
+		{":explain %d", 10, []string{"db", "dc1"}},
+	}
+
+	r := testRepl()
+	for _, test := range tests {
+		start, candidates := r.complete(test.line)
+		if start != test.start || !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("complete(%q)\n got: %d %v\nwant: %d %v",
+				test.line, start, candidates, test.start, test.candidates)
+		}
+	}
+}
+
+func testEditor(input string, history ...string) (*lineEditor, *bytes.Buffer) {
+	var out bytes.Buffer
+	r := testRepl()
+	editor := &lineEditor{
+		in:       bufio.NewReader(strings.NewReader(input)),
+		out:      &out,
+		complete: r.complete,
+		history:  func() []string { return history },
+	}
+	return editor, &out
+}
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		input    string
+		history  []string
+		expected []string
+	}{
+		{"%dc1\r", nil, []string{"%dc1"}},
+		{"%dc1\r\nab\n", nil, []string{"%dc1", "ab"}},
+		{"abc\x7f\x08d\r", nil, []string{"ad"}},
+		{"%dc\t:DO\t\r", nil, []string{"%dc1:DOWN"}},
+		{"%d\t\tc\t\r", nil, []string{"%dc1"}},
+		{"\x1b[A\x1b[A\r", []string{"a", "b"}, []string{"a"}},
+		{"x\x1b[A\x1b[B\r", []string{"a"}, []string{"x"}},
+		{"x\x1b[A\x1b[A\x1b[B\r", []string{"a", "b"}, []string{"b"}},
+		{"ab\x03cd\r", nil, []string{"", "cd"}},
+		{"a\x04\r\x04", nil, []string{"a"}},
+		{"é\r", nil, []string{"é"}},
+	}
+
+	for _, test := range tests {
+		editor, _ := testEditor(test.input, test.history...)
+		lines := []string{}
+		for {
+			line, err := editor.ReadLine(prompt)
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+		}
+
+		if !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("ReadLine(%q)\n got: %q\nwant: %q", test.input, lines, test.expected)
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected string
+	}{
+		{[]string{"dc1"}, "dc1"},
+		{[]string{"db", "dc1"}, "d"},
+		{[]string{"dc1", "dc"}, "dc"},
+		{[]string{"café1", "café2"}, "café"},
+		{[]string{"cé", "cè"}, "c"},
+		{[]string{"a", "b"}, ""},
+	}
+
+	for _, test := range tests {
+		if actual := commonPrefix(test.values); actual != test.expected {
+			t.Errorf("commonPrefix(%q) = %q, want %q", test.values, actual, test.expected)
+		}
+	}
+}
+
+func TestLineEditorOutput(t *testing.T) {
+	editor, out := testEditor("%d\t\t\r")
+	editor.ReadLine(prompt)
+	editor.Write([]byte("a\nb\n"))
+
+	expected := "\r\x1b[Kgrange> " +
+		"\r\x1b[Kgrange> %" +
+		"\r\x1b[Kgrange> %d" +
+		"\r\n" + "db  dc1\r\n" + "\r\x1b[Kgrange> %d" +
+		"\r\n" + "db  dc1\r\n" + "\r\x1b[Kgrange> %d" +
+		"\r\n" +
+		"a\r\nb\r\n"
+	if out.String() != expected {
+		t.Errorf("Output\n got: %q\nwant: %q", out.String(), expected)
+	}
+}
+
+func TestReplPiped(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-dir", dir, "repl"}, strings.NewReader(":compress %dc1\n:quit\n"), &stdout, &stderr)
+
+	if code != 0 {
+		t.Errorf("repl exited %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "grange> :compress %dc1\nweb1..3\n(3 values in ") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
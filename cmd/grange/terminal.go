@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// A terminal is the line-based I/O used by the REPL, so that it can be driven
+// by tests without a real terminal.
+type terminal interface {
+	// ReadLine prompts for and returns the next line, or io.EOF once there is
+	// no more input.
+	ReadLine(prompt string) (string, error)
+	io.Writer
+}
+
+// A completer returns the candidates for the word at the end of line, and the
+// offset in bytes where that word starts.
+type completer func(line string) (int, []string)
+
+// plainTerminal reads whole lines, such as from a pipe. Prompts and input are
+// echoed so that output reads the same as an interactive session.
+type plainTerminal struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (t *plainTerminal) ReadLine(prompt string) (string, error) {
+	line, err := t.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	io.WriteString(t.out, prompt+line+"\n")
+	return line, nil
+}
+
+func (t *plainTerminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// lineEditor reads keystrokes from a terminal in raw mode, supporting
+// backspace, tab completion and up/down to move through history.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete completer
+	history  func() []string
+}
+
+const (
+	keyInterrupt = 3
+	keyEOF       = 4
+	keyBackspace = 8
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	line := []rune{}
+	history := e.history()
+	index := len(history)
+	edited := ""
+
+	e.redraw(prompt, line)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			// Enter sends \r in raw mode, but accept \r\n as well.
+			if next, err := e.in.Peek(1); r == '\r' && err == nil && next[0] == '\n' {
+				e.in.ReadByte()
+			}
+			io.WriteString(e.out, "\r\n")
+			return string(line), nil
+		case keyInterrupt:
+			io.WriteString(e.out, "^C\r\n")
+			return "", nil
+		case keyEOF:
+			if len(line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case '\t':
+			line = e.completeLine(prompt, line)
+		case keyEscape:
+			// Only the up and down arrows are supported, other sequences are
+			// ignored.
+			if b, _ := e.in.ReadByte(); b != '[' {
+				break
+			}
+			switch b, _ := e.in.ReadByte(); b {
+			case 'A':
+				if index > 0 {
+					if index == len(history) {
+						edited = string(line)
+					}
+					index--
+					line = []rune(history[index])
+				}
+			case 'B':
+				if index < len(history) {
+					index++
+					if index == len(history) {
+						line = []rune(edited)
+					} else {
+						line = []rune(history[index])
+					}
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line, r)
+			}
+		}
+		e.redraw(prompt, line)
+	}
+}
+
+func (e *lineEditor) completeLine(prompt string, line []rune) []rune {
+	s := string(line)
+	start, candidates := e.complete(s)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return line
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(prefix) > len(s)-start {
+		return []rune(s[:start] + prefix)
+	}
+
+	io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	return line
+}
+
+func (e *lineEditor) redraw(prompt string, line []rune) {
+	io.WriteString(e.out, "\r\x1b[K"+prompt+string(line))
+}
+
+// Write translates newlines, since the terminal does not in raw mode.
+func (e *lineEditor) Write(p []byte) (int, error) {
+	_, err := io.WriteString(e.out, strings.Replace(string(p), "\n", "\r\n", -1))
+	return len(p), err
+}
+
+// commonPrefix compares runes rather than bytes, so that the prefix of
+// values such as "é" and "è" does not end with half a character.
+func commonPrefix(values []string) string {
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		i := 0
+		for _, r := range value {
+			if i == len(prefix) || prefix[i] != r {
+				break
+			}
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+// newTerminal returns a line editor if in is an interactive terminal that
+// could be put in raw mode, otherwise a plain terminal. The returned function
+// restores the terminal's original mode.
+func newTerminal(in io.Reader, out io.Writer, complete completer, history func() []string) (terminal, func()) {
+	if f, ok := in.(*os.File); ok {
+		if restore, err := makeRaw(f); err == nil {
+			editor := &lineEditor{bufio.NewReader(in), out, complete, history}
+			return editor, restore
+		}
+	}
+	return &plainTerminal{bufio.NewReader(in), out}, func() {}
+}
+
+// makeRaw uses stty rather than ioctls, so that it works on any unix without
+// platform specific code.
+func makeRaw(f *os.File) (func(), error) {
+	if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, os.ErrInvalid
+	}
+
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		return cmd.Output()
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(string(saved))) }, nil
+}
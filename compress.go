@@ -1,6 +1,7 @@
 package grange
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
@@ -14,17 +15,88 @@ var (
 	_ = fmt.Println
 )
 
+// A CompressStrategy turns a set of values into a range expression that
+// expands back to exactly the same set.
+type CompressStrategy func(values []string) string
+
+var (
+	// DomainStrategy splits each value at the first "." and compresses the
+	// hostnames within each domain, like libcrange does. This is the default.
+	// Its output matches libcrange's, so that it can be read by libcrange
+	// clients, such as those of Handler: numbers are only compressed into
+	// ascending decimal ranges such as web1..4.
+	DomainStrategy CompressStrategy = compressDomain
+
+	// LevelStrategy factors out common labels at every "."-separated level, so
+	// that web1.dc1.example.com,web1.dc2.example.com becomes
+	// web1.{dc1,dc2}.example.com. It is the only strategy that also uses
+	// stepped, hex and multi-dimensional ranges, such as web1..9/2,
+	// node0x0a..0x1f and r1..4-h1..20, which libcrange does not understand.
+	LevelStrategy CompressStrategy = compressLevels
+
+	// ShortestStrategy tries all of the above and returns the shortest result.
+	ShortestStrategy CompressStrategy = compressShortest
+)
+
+var (
+	literalRegexp = regexp.MustCompile("^[a-zA-Z0-9._][a-zA-Z0-9._:-]*$")
+)
+
 // Normalizes a result set into a minimal range expression, such as
-// +{foo,bar}.example.com+.
-func Compress(nodes *Result) string {
+// +{foo,bar}.example.com+. The expression expands back to exactly the same
+// result, but large results that do not compress well can give an expression
+// longer than MaxQuerySize, which State.Query will refuse. Values that are not
+// valid range literals, such as those containing "," or "{", are quoted as ""
+// constants. An error is returned if the result contains values that could
+// not be returned by a query, because they are longer than MaxQuerySize.
+func Compress(nodes *Result) (string, error) {
+	return CompressWith(nodes, DomainStrategy)
+}
+
+// CompressWith is like Compress but uses the given strategy.
+func CompressWith(nodes *Result, strategy CompressStrategy) (string, error) {
+	values := []string{}
+	quoted := []string{}
+	for node := range nodes.Iter() {
+		value := node.(string)
+		if len(value) > MaxQuerySize {
+			return "", errors.New(
+				fmt.Sprintf("Cannot compress value longer than max query size: %s...", value[0:20]))
+		}
+
+		if literalRegexp.MatchString(value) && !isRange(value) {
+			values = append(values, value)
+		} else {
+			quoted = append(quoted, value)
+		}
+	}
+	sort.Sort(sortorder.Natural(values))
+	sort.Sort(sortorder.Natural(quoted))
+
+	result := []string{}
+	if len(values) > 0 {
+		result = append(result, strategy(values))
+	}
+	for _, value := range quoted {
+		result = append(result, quote(value))
+	}
+	return strings.Join(result, ","), nil
+}
+
+func isRange(value string) bool {
+	return numericRangeRegexp.MatchString(value) || hexRangeRegexp.MatchString(value)
+}
+
+func compressDomain(values []string) string {
 	noDomain := []string{}
 	domains := map[string][]string{}
-	for node := range nodes.Iter() {
-		tokens := strings.SplitN(node.(string), ".", 2)
-		if len(tokens) == 2 {
+	for _, node := range values {
+		tokens := strings.SplitN(node, ".", 2)
+		// An empty hostname cannot be represented inside braces.
+		if len(tokens) == 2 && tokens[0] != "" {
 			domains[tokens[1]] = append(domains[tokens[1]], tokens[0])
 		} else {
-			noDomain = append(noDomain, node.(string))
+			noDomain = append(noDomain, node)
 		}
 	}
 	sort.Sort(sortorder.Natural(noDomain))
@@ -49,6 +121,144 @@ func Compress(nodes *Result) string {
 	return strings.Join(result, ",")
 }
 
+func compressShortest(values []string) string {
+	result := compressDomain(values)
+	if levels := compressLevels(values); len(levels) < len(result) {
+		result = levels
+	}
+	return result
+}
+
+// A term is the product of a set of labels at each level, joined by ".".
+type term [][]string
+
+// compressLevels merges terms that differ in only one level, since
+// {a}.{x}.c,{a}.{y}.c is the same as {a}.{x,y}.c. The order levels are merged
+// in affects the result, so both left-to-right and right-to-left are tried.
+func compressLevels(values []string) string {
+	forwards := renderTerms(mergeTerms(values, false))
+	backwards := renderTerms(mergeTerms(values, true))
+
+	if len(backwards) < len(forwards) {
+		return backwards
+	}
+	return forwards
+}
+
+func mergeTerms(values []string, reverse bool) []term {
+	byLength := map[int][]term{}
+	for _, value := range values {
+		labels := strings.Split(value, ".")
+		t := term{}
+		for _, label := range labels {
+			t = append(t, []string{label})
+		}
+		byLength[len(labels)] = append(byLength[len(labels)], t)
+	}
+
+	result := []term{}
+	for length, terms := range byLength {
+		for merged := true; merged; {
+			merged = false
+			for i := 0; i < length; i++ {
+				level := i
+				if reverse {
+					level = length - i - 1
+				}
+
+				var changed bool
+				terms, changed = mergeLevel(terms, level)
+				merged = merged || changed
+			}
+		}
+		result = append(result, terms...)
+	}
+	return result
+}
+
+// mergeLevel unions the labels at level of terms that are identical at every
+// other level.
+func mergeLevel(terms []term, level int) ([]term, bool) {
+	keys := []string{}
+	buckets := map[string]term{}
+
+	for i, t := range terms {
+		key := t.keyWithout(level)
+		for _, label := range t[level] {
+			if !literalRegexp.MatchString(label) {
+				// Labels that are empty or start with "-" or ":" cannot be
+				// represented inside braces, so are never merged.
+				key = fmt.Sprintf("%s\x02%d", key, i)
+			}
+		}
+
+		if existing, ok := buckets[key]; ok {
+			existing[level] = append(existing[level], t[level]...)
+		} else {
+			merged := make(term, len(t))
+			for l := range t {
+				merged[l] = append([]string{}, t[l]...)
+			}
+			buckets[key] = merged
+			keys = append(keys, key)
+		}
+	}
+
+	result := []term{}
+	for _, key := range keys {
+		t := buckets[key]
+		sort.Sort(sortorder.Natural(t[level]))
+		result = append(result, t)
+	}
+	return result, len(result) != len(terms)
+}
+
+func (t term) keyWithout(level int) string {
+	parts := []string{}
+	for l, labels := range t {
+		if l == level {
+			parts = append(parts, "")
+		} else {
+			parts = append(parts, strings.Join(labels, "\x00"))
+		}
+	}
+	return strings.Join(parts, "\x01")
+}
+
+// renderTerms joins terms with ",". Brace expansion has the same precedence
+// as union, so braces after the start of a term would apply to every term
+// before it: terms other than the first are bracketed if they have them.
+func renderTerms(terms []term) string {
+	result := []string{}
+	for _, t := range terms {
+		result = append(result, t.String())
+	}
+	sort.Sort(sortorder.Natural(result))
+	for i := 1; i < len(result); i++ {
+		if strings.LastIndex(result[i], "{") > 0 {
+			result[i] = "(" + result[i] + ")"
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+func (t term) String() string {
+	if len(t) == 1 {
+		return strings.Join(compressProgressions(t[0]), ",")
+	}
+
+	levels := []string{}
+	for _, labels := range t {
+		compressed := compressProgressions(labels)
+		joined := strings.Join(compressed, ",")
+		if len(compressed) > 1 {
+			joined = "{" + joined + "}"
+		}
+		levels = append(levels, joined)
+	}
+	return strings.Join(levels, ".")
+}
+
 func numericExpansionFor(prefix string, start string, end string, suffix string) string {
 	endN, _ := strconv.Atoi(end)
 	startN, _ := strconv.Atoi(start)
@@ -60,6 +270,9 @@ func numericExpansionFor(prefix string, start string, end string, suffix string)
 	}
 }
 
+// compressNumeric replaces runs of consecutive decimal numbers at the end of
+// adjacent values with ranges, as libcrange does. See compressProgressions
+// for the other kinds of ranges.
 func compressNumeric(nodes []string) []string {
 	r := regexp.MustCompile("^(.*?)(\\d+)([^\\d]*)$")
 
@@ -97,11 +310,11 @@ func compressNumeric(nodes []string) []string {
 				flush()
 			}
 
-			//if len(n) != len(currentNstr) {
-			//flush
 			newN, _ := strconv.Atoi(n)
 
-			if zeroCount(n) != zeroCount(currentNstr) && len(n) != len(currentNstr) {
+			// Ranges expand using the width of the start number, so n can only
+			// continue the run if it is padded to the same width.
+			if startN > -1 && fmt.Sprintf("%0*d", len(start), newN) != n {
 				flush()
 			}
 
@@ -122,13 +335,201 @@ func compressNumeric(nodes []string) []string {
 	return result
 }
 
-func zeroCount(n string) int {
-	count := 0
-	for _, c := range n {
-		if c != '0' {
-			break
+var (
+	hexSuffixRegexp = regexp.MustCompile("^(.*?0[xX])([[:xdigit:]]+)$")
+	digitsRegexp    = regexp.MustCompile("\\d+")
+)
+
+// A numberField is a single number or a range of them within a label.
+type numberField struct {
+	hex    bool
+	marker string // 0x or 0X, for hex numbers
+	start  string
+	end    string
+	step   int64
+}
+
+func (f numberField) value(n string) int64 {
+	base := 10
+	if f.hex {
+		base = 16
+	}
+	v, _ := strconv.ParseInt(n, base, 64)
+	return v
+}
+
+// format pads v to width using the same case as the start of the field, so
+// that a run can only continue if a range starting there expands to exactly
+// the original value.
+func (f numberField) format(v int64, width int) string {
+	verb := "d"
+	if f.hex {
+		verb = "x"
+		if strings.ToLower(f.start) != f.start {
+			verb = "X"
+		}
+	}
+	return fmt.Sprintf("%0*"+verb, width, v)
+}
+
+func (f numberField) String() string {
+	if f.start == f.end {
+		return f.start
+	}
+
+	result := f.start + ".."
+	if f.hex {
+		result += f.marker + f.format(f.value(f.end), 0)
+	} else {
+		result += strconv.FormatInt(f.value(f.end), 10)
+	}
+	if f.step > 1 {
+		result += "/" + strconv.FormatInt(f.step, 10)
+	}
+	return result
+}
+
+// A numbered label is split into the text around its numbers. Labels with the
+// same text can be merged one field at a time, so that r1-h1,r1-h2,r2-h1,r2-h2
+// becomes r1..2-h1..2.
+type numbered struct {
+	text   []string
+	fields []numberField
+}
+
+func splitNumbers(label string) (numbered, bool) {
+	var hex *numberField
+	text := label
+	if match := hexSuffixRegexp.FindStringSubmatch(label); match != nil {
+		text = match[1][:len(match[1])-2]
+		hex = &numberField{hex: true, marker: match[1][len(text):], start: match[2], end: match[2]}
+	}
+
+	n := numbered{}
+	last := 0
+	// A number directly before a 0x marker would run into it when expanded,
+	// so is left as text.
+	if hex == nil || !strings.HasSuffix(digitsRegexp.ReplaceAllString(text, "0"), "0") {
+		for _, loc := range digitsRegexp.FindAllStringIndex(text, -1) {
+			n.text = append(n.text, text[last:loc[0]])
+			n.fields = append(n.fields, numberField{start: text[loc[0]:loc[1]], end: text[loc[0]:loc[1]]})
+			last = loc[1]
+		}
+	}
+	n.text = append(n.text, text[last:])
+
+	if hex != nil {
+		n.text[len(n.text)-1] += hex.marker
+		n.fields = append(n.fields, *hex)
+		n.text = append(n.text, "")
+	}
+	return n, len(n.fields) > 0
+}
+
+func (n numbered) String() string {
+	result := n.text[0]
+	for i, field := range n.fields {
+		result += field.String() + n.text[i+1]
+	}
+	return result
+}
+
+// compressProgressions is like compressNumeric, but also finds runs with a
+// constant step, runs of hex numbers and grids of runs over more than one
+// number. Values are grouped by the text around their numbers first, so runs
+// do not need to be adjacent in sort order.
+func compressProgressions(nodes []string) []string {
+	result := []string{}
+	keys := []string{}
+	groups := map[string][]numbered{}
+
+	for _, node := range nodes {
+		n, ok := splitNumbers(node)
+		if !ok {
+			result = append(result, node)
+			continue
+		}
+
+		key := strings.Join(n.text, "\x00")
+		if n.fields[len(n.fields)-1].hex {
+			key += "\x01"
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
 		}
-		count++
+		groups[key] = append(groups[key], n)
 	}
-	return count
+
+	for _, key := range keys {
+		terms := groups[key]
+		for i := len(terms[0].fields) - 1; i >= 0; i-- {
+			terms = mergeField(terms, i)
+		}
+		for _, t := range terms {
+			result = append(result, t.String())
+		}
+	}
+
+	sort.Sort(sortorder.Natural(result))
+	return result
+}
+
+// mergeField replaces runs of the single numbers at field i with ranges, for
+// terms that are identical in every other field.
+func mergeField(terms []numbered, i int) []numbered {
+	keys := []string{}
+	buckets := map[string][]numbered{}
+	for _, t := range terms {
+		parts := []string{}
+		for j, field := range t.fields {
+			if j != i {
+				parts = append(parts, field.String())
+			}
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], t)
+	}
+
+	result := []numbered{}
+	for _, key := range keys {
+		bucket := buckets[key]
+		sort.SliceStable(bucket, func(a, b int) bool {
+			f := bucket[a].fields[i]
+			return f.value(f.start) < f.value(bucket[b].fields[i].start)
+		})
+
+		for j := 0; j < len(bucket); {
+			first := bucket[j].fields[i]
+			start := first.value(first.start)
+			k := j + 1
+			step := int64(0)
+			if k < len(bucket) {
+				step = first.value(bucket[k].fields[i].start) - start
+			}
+
+			for step > 0 && k < len(bucket) {
+				n := bucket[k].fields[i].start
+				if first.value(n) != start+int64(k-j)*step || first.format(first.value(n), len(first.start)) != n {
+					break
+				}
+				k++
+			}
+
+			// A stepped range is only shorter than the values it replaces if
+			// it covers at least three of them.
+			if k-j < 2 || (step > 1 && k-j < 3) {
+				k = j + 1
+			}
+
+			merged := numbered{text: bucket[j].text, fields: append([]numberField{}, bucket[j].fields...)}
+			merged.fields[i].end = bucket[k-1].fields[i].start
+			merged.fields[i].step = step
+			result = append(result, merged)
+			j = k
+		}
+	}
+	return result
 }
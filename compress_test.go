@@ -3,6 +3,7 @@ package grange
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,10 +40,201 @@ func TestCompress(t *testing.T) {
 	})
 }
 
+var levelTests = []struct {
+	values   []interface{}
+	expected string
+}{
+	{[]interface{}{"a", "b", "c"}, "a,b,c"},
+	{[]interface{}{"web1.dc1.example.com", "web2.dc1.example.com"},
+		"web1..2.dc1.example.com"},
+	{[]interface{}{"web1.dc1.example.com", "web1.dc2.example.com"},
+		"web1.dc1..2.example.com"},
+	{[]interface{}{"web1.dc1", "web2.dc1", "web1.dc2", "web2.dc2"},
+		"web1..2.dc1..2"},
+	{[]interface{}{"web1.dc1", "db1.dc1", "db1.dc2", "host"},
+		"db1.dc1..2,host,web1.dc1"},
+	{[]interface{}{"a.", "b.", "a"}, "a,{a,b}."},
+	{[]interface{}{"web1.-ilo.dc1", "web1.ilo.dc1"}, "web1.-ilo.dc1,web1.ilo.dc1"},
+	{[]interface{}{"web09", "web010", "web011"}, "web09,web010..11"},
+	{[]interface{}{"web1", "web3", "web5"}, "web1..5/2"},
+	{[]interface{}{"web1", "web3"}, "web1,web3"},
+	{[]interface{}{"web1", "web3", "web4", "web5"}, "web1,web3..5"},
+	{[]interface{}{"web1a", "web4a", "web7a", "web8"}, "web1..7/3a,web8"},
+	{[]interface{}{"n0x0a", "n0x0b", "n0x0c"}, "n0x0a..0xc"},
+	{[]interface{}{"n0x0A", "n0x0B"}, "n0x0A..0xB"},
+	{[]interface{}{"n0x0f", "n0x0F"}, "n0x0F,n0x0f"},
+	{[]interface{}{"n0x00", "n0x10", "n0x20"}, "n0x00..0x20/16"},
+	{[]interface{}{"n0x1.dc1", "n0x2.dc1"}, "n0x1..0x2.dc1"},
+	{[]interface{}{"web1.dc1", "web2.dc1", "web3.dc2"}, "web1..2.dc1,web3.dc2"},
+	{[]interface{}{"r1-h1", "r1-h2", "r2-h1", "r2-h2"}, "r1..2-h1..2"},
+	{[]interface{}{"r1-h1", "r1-h2", "r2-h1"}, "r1-h1..2,r2-h1"},
+	{[]interface{}{"r1-h1", "r3-h1", "r5-h1", "r1-h2", "r3-h2", "r5-h2"}, "r1..5/2-h1..2"},
+	{[]interface{}{"r1-n0x0a", "r1-n0x0b", "r2-n0x0a", "r2-n0x0b"}, "r1..2-n0x0a..0xb"},
+	{[]interface{}{"r10x1", "r10x2"}, "r10x1..0x2"},
+	{[]interface{}{"r1-h1.dc1", "r1-h2.dc1", "r2-h1.dc1", "r2-h2.dc1", "r1-h1.dc2"},
+		"r1-h1.dc2,r1..2-h1..2.dc1"},
+	// Brace expansion applies to everything before it, so terms after the
+	// first need brackets.
+	{[]interface{}{"a", "web.x", "web.y"}, "a,(web.{x,y})"},
+	{[]interface{}{"a", "web1.dc1.example.com", "web1.dcx.example.com"},
+		"a,(web1.{dc1,dcx}.example.com)"},
+	{[]interface{}{"web.x", "web.y", "zz.a", "zz.b"}, "web.{x,y},(zz.{a,b})"},
+	{[]interface{}{"a", "a.x", "b.x", "a.y", "b.y"}, "a,({a,b}.{x,y})"},
+}
+
+func TestCompressLevels(t *testing.T) {
+	for _, test := range levelTests {
+		result := NewResult(test.values...)
+		actual, _ := CompressWith(&result, LevelStrategy)
+
+		if actual != test.expected {
+			t.Errorf("CompressWith(%v)\n got: %s\nwant: %s", test.values, actual, test.expected)
+		}
+		testEval(t, result, actual, emptyState())
+	}
+}
+
+// The default strategy only produces ranges that libcrange understands.
+func TestCompressDomainRanges(t *testing.T) {
+	testCompress(t, "web1,web3,web5", DomainStrategy, NewResult("web1", "web3", "web5"))
+	testCompress(t, "n0x0a,n0x0b,n0x0c", DomainStrategy, NewResult("n0x0a", "n0x0b", "n0x0c"))
+	testCompress(t, "r1-h1..2,r2-h1..2", DomainStrategy, NewResult("r1-h1", "r1-h2", "r2-h1", "r2-h2"))
+	testCompress(t, "web1..3", DomainStrategy, NewResult("web1", "web2", "web3"))
+}
+
+func TestCompressShortest(t *testing.T) {
+	testCompress(t, "web1.dc1..2.example.com", ShortestStrategy,
+		NewResult("web1.dc1.example.com", "web1.dc2.example.com"))
+	testCompress(t, "web1..2.example.com", ShortestStrategy,
+		NewResult("web1.example.com", "web2.example.com"))
+}
+
+func TestCompressQuotesRanges(t *testing.T) {
+	testCompress(t, `"a1..3/2","n0x1..0x2"`, DomainStrategy, NewResult("a1..3/2", "n0x1..0x2"))
+	testCompress(t, `"a1..3/2","n0x1..0x2"`, LevelStrategy, NewResult("a1..3/2", "n0x1..0x2"))
+}
+
+func testCompress(t *testing.T, expected string, strategy CompressStrategy, result Result) {
+	actual, err := CompressWith(&result, strategy)
+
+	if err != nil {
+		t.Errorf("Compress(%v) returned error: %s", result, err)
+	} else if actual != expected {
+		t.Errorf("Compress\n got: %s\nwant: %s", actual, expected)
+	}
+}
+
+func TestCompressQuoted(t *testing.T) {
+	testCompress(t, `a,"",",","-a","Web 1","\\\"\\","a1..2","q(x)","x://blah","{a}"`,
+		DomainStrategy,
+		NewResult("a", "", ",", "-a", "Web 1", "a1..2", "q(x)", "x://blah", "{a}", `\"\`))
+
+	for _, value := range []string{"a,b", "a)", `"`, `\`, `a\b`, `\"`, "\xff", "é\n"} {
+		result := NewResult(value, "b")
+		compressed, _ := Compress(&result)
+		testEval(t, result, compressed, emptyState())
+	}
+}
+
+func TestCompressErrors(t *testing.T) {
+	result := NewResult("a", strings.Repeat("b", MaxQuerySize+1))
+	_, err := Compress(&result)
+
+	expected := "Cannot compress value longer than max query size: bbbbbbbbbbbbbbbbbbbb..."
+	if err == nil {
+		t.Errorf("Expected error but none returned")
+	} else if err.Error() != expected {
+		t.Errorf("Different error returned.\n got: %s\nwant: %s", err.Error(), expected)
+	}
+}
+
+// Compressing a large irregular set is not an error, even though the result
+// is too long to be queried.
+func TestCompressLongerThanMaxQuerySize(t *testing.T) {
+	result := NewResult()
+	for i := 0; i < 500; i++ {
+		result.Add(fmt.Sprintf("host%d.dc%d", i*7, i))
+	}
+
+	compressed, err := Compress(&result)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(compressed) <= MaxQuerySize {
+		t.Fatalf("Expected compressed result longer than %d, got %d", MaxQuerySize, len(compressed))
+	}
+
+	state := emptyState()
+	testError2(t, fmt.Sprintf("Query is too long, max length is %d", MaxQuerySize), compressed, state)
+
+	defer func(size int) { MaxQuerySize = size }(MaxQuerySize)
+	MaxQuerySize = len(compressed)
+	testEval(t, result, compressed, state)
+}
+
+// Generates random sets of hostnames, and checks that compressing them with
+// every strategy expands back to the same set. Each set has several groups of
+// values, which share a prefix and usually a domain but vary in numbers and
+// in the labels in between.
+func TestCompressRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	prefixes := []string{"", "web", "db", "r1-web", "host_", "a1b", "r1-h", "r2-h", "r3-h", "r02-h", "."}
+	suffixes := []string{"", "", "a", "-ilo", ".", " ", ",", ")", `"`}
+	labels := []string{"x", "y", "web", "db", "dc1", "dc2", "ilo", "-ilo", ""}
+	domains := []string{"", "", "dc1", "dc2", "dc10.example.com", "-ilo.dc1", "ilo.dc1", "9"}
+	strategies := []CompressStrategy{DomainStrategy, LevelStrategy, ShortestStrategy}
+	pick := func(values []string) string { return values[r.Intn(len(values))] }
+
+	for i := 0; i < 500; i++ {
+		result := NewResult()
+		for g := r.Intn(4); g >= 0; g-- {
+			prefix, domain := pick(prefixes), pick(domains)
+			for j := r.Intn(12); j >= 0; j-- {
+				value := prefix
+				switch r.Intn(5) {
+				case 0:
+				case 1:
+					value += fmt.Sprintf("0x%0*x", r.Intn(4), r.Intn(300))
+				default:
+					value += fmt.Sprintf("%0*d", r.Intn(4), r.Intn(120))
+				}
+				value += pick(suffixes)
+				for k := r.Intn(3); k > 0; k-- {
+					value += "." + pick(labels)
+				}
+				if r.Intn(4) == 0 {
+					// An unshared domain.
+					value += "." + pick(domains)
+				} else if domain != "" {
+					value += "." + domain
+				}
+				result.Add(value)
+			}
+		}
+
+		for _, strategy := range strategies {
+			compressed, err := CompressWith(&result, strategy)
+			if err != nil {
+				t.Errorf("Compress(%v) returned error: %s", result, err)
+				continue
+			}
+
+			actual, err := emptyState().Query(compressed)
+			if err != nil {
+				t.Errorf("Compress(%v) = %s, which errors: %s", result, compressed, err)
+			} else if !actual.Equal(result.Set) {
+				t.Errorf("Compress(%v) = %s, which expands to %v", result, compressed, actual)
+			}
+		}
+	}
+}
+
 func runSpec(t *testing.T, spec RangeSpec) {
-	actual := Compress(&spec.results)
+	actual, err := Compress(&spec.results)
 
-	if actual != spec.expr {
+	if err != nil {
+		t.Errorf("failed %s:%d\n%s", spec.path, spec.line, err)
+	} else if actual != spec.expr {
 		t.Errorf("failed %s:%d\n got: %s\nwant: %s",
 			spec.path, spec.line, actual, spec.expr)
 	}
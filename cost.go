@@ -0,0 +1,133 @@
+package grange
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cost measures the work done to evaluate a query, so that expensive queries
+// can be limited or accounted for. See QueryCost.
+//
+// Values at cluster keys are only evaluated the first time they are looked
+// up, so queries cost less once the cache is primed, and less again when
+// their subexpressions are found in the memo cache.
+type Cost struct {
+	// Expressions evaluated, including those in cluster values.
+	Nodes int
+
+	// Cluster keys looked up, such as by %dc1:KEY or has(TYPE;redis).
+	Lookups int
+
+	// Values tested against regexes.
+	Matches int
+
+	// Values produced by brace expansion, such as 3 for {a,b,c}.
+	Products int
+}
+
+// Total is the cost that budgets are compared against, the sum of the
+// individual counts.
+func (c Cost) Total() int {
+	return c.Nodes + c.Lookups + c.Matches + c.Products
+}
+
+func (c Cost) String() string {
+	return fmt.Sprintf("%d (nodes=%d lookups=%d matches=%d products=%d)",
+		c.Total(), c.Nodes, c.Lookups, c.Matches, c.Products)
+}
+
+// A CostError is returned for queries that are aborted because their cost
+// exceeded the budget. Cost is what had been spent when it was aborted.
+type CostError struct {
+	Query  string
+	Budget int
+	Cost   Cost
+}
+
+func (e *CostError) Error() string {
+	return fmt.Sprintf("Query exceeded maximum cost of %d: %s", e.Budget, e.Query)
+}
+
+type costKind int
+
+const (
+	costNode costKind = iota
+	costLookup
+	costMatch
+	costProduct
+)
+
+// costMeter accumulates the cost of a single query, shared by every context
+// used to evaluate it.
+type costMeter struct {
+	query  string
+	cost   Cost
+	budget int
+	err    *CostError
+}
+
+// QueryCost is like Query, but also returns the cost of evaluating the query.
+// If the total cost exceeds budget, evaluation is aborted and a *CostError is
+// returned. A budget of zero or less uses MaxQueryCost.
+func (state *State) QueryCost(input string, budget int) (Result, Cost, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if budget <= 0 {
+		budget = MaxQueryCost
+	}
+	meter := &costMeter{query: input, budget: budget}
+
+	if state.observer == nil {
+		result, err := state.query(input, meter)
+		return result, meter.cost, err
+	}
+
+	state.observer.QueryStart(input)
+	start := time.Now()
+	result, err := state.query(input, meter)
+	state.observer.QueryEnd(input, time.Since(start), result.Cardinality(), err)
+
+	if _, ok := err.(*ParseError); ok {
+		state.observer.ParseError(input, err)
+	}
+	return result, meter.cost, err
+}
+
+// charge adds n to the cost of the query being evaluated, aborting it once
+// the budget is exceeded. Contexts that are not part of a query, such as
+// those used to prime the cache, are not charged.
+func (c *evalContext) charge(kind costKind, n int) {
+	m := c.cost
+	if m == nil {
+		return
+	}
+
+	switch kind {
+	case costNode:
+		m.cost.Nodes += n
+	case costLookup:
+		m.cost.Lookups += n
+	case costMatch:
+		m.cost.Matches += n
+	case costProduct:
+		m.cost.Products += n
+	}
+
+	if m.err == nil && m.budget > 0 && m.cost.Total() > m.budget {
+		m.err = &CostError{m.query, m.budget, m.cost}
+	}
+	if m.err != nil {
+		panic(m.err)
+	}
+}
+
+// costErr returns the error the query was aborted with, if any. Some
+// expressions ignore errors from their parts, so this must be checked before
+// results are trusted, such as to cache them.
+func (c *evalContext) costErr() error {
+	if c.cost == nil || c.cost.err == nil {
+		return nil
+	}
+	return c.cost.err
+}
@@ -0,0 +1,97 @@
+package grange
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryCost(t *testing.T) {
+	state := costState()
+
+	tests := []struct {
+		query string
+		cost  Cost
+	}{
+		{"a", Cost{Nodes: 1}},
+		{"a1..3", Cost{Nodes: 1}},
+		{"{a,b}c", Cost{Nodes: 6, Products: 2}},
+		{"%b", Cost{Nodes: 8, Lookups: 2}},
+		// Values of b and a are now cached.
+		{"%b", Cost{Nodes: 3, Lookups: 1}},
+		{"%b & /1/", Cost{Nodes: 5, Lookups: 1, Matches: 4}},
+	}
+	for _, test := range tests {
+		_, cost, err := state.QueryCost(test.query, 0)
+		if err != nil {
+			t.Errorf("QueryCost(%s) returned error: %s", test.query, err)
+		}
+		if cost != test.cost {
+			t.Errorf("QueryCost(%s) cost = %+v, expected %+v", test.query, cost, test.cost)
+		}
+	}
+}
+
+func TestQueryCostBudget(t *testing.T) {
+	state := NewState()
+	for i := 0; i < 100; i++ {
+		state.AddCluster(fmt.Sprintf("c%d", i), Cluster{"CLUSTER": []string{"x"}, "TYPE": []string{"redis"}})
+	}
+
+	query := "%{has(TYPE;redis)}"
+	result, cost, err := state.QueryCost(query, 50)
+	costErr, ok := err.(*CostError)
+	if !ok {
+		t.Fatalf("Expected a *CostError, got: %v", err)
+	}
+	if costErr.Budget != 50 || costErr.Cost.Total() != 51 || costErr.Query != query {
+		t.Errorf("Unexpected error: %+v", costErr)
+	}
+	if cost != costErr.Cost {
+		t.Errorf("Expected cost %+v to be that of the error %+v", cost, costErr.Cost)
+	}
+	if result.Cardinality() != 0 {
+		t.Errorf("Expected empty result, got: %s", result)
+	}
+
+	// Nothing partially evaluated was cached.
+	testEval(t, NewResult("x"), query, &state)
+	testEval(t, NewResult("x"), "%c99", &state)
+}
+
+func TestQueryCostBracesBudget(t *testing.T) {
+	state := emptyState()
+
+	// Brace expansion ignores errors from its parts, which must not hide the
+	// query being aborted.
+	_, _, err := state.QueryCost("{a,b}{c,d}{e,f}{g,h}", 20)
+	if _, ok := err.(*CostError); !ok {
+		t.Errorf("Expected a *CostError, got: %v", err)
+	}
+}
+
+func TestMaxQueryCost(t *testing.T) {
+	defer func(max int) { MaxQueryCost = max }(MaxQueryCost)
+	MaxQueryCost = 3
+
+	state := costState()
+	testError2(t, "Query exceeded maximum cost of 3: %b", "%b", state)
+	testEval(t, NewResult("a", "b"), "a,b", state)
+
+	// An explicit budget overrides the default.
+	if _, _, err := state.QueryCost("%b", 100); err != nil {
+		t.Errorf("Expected no error, got: %s", err)
+	}
+}
+
+func TestHandlerRangeCost(t *testing.T) {
+	h, _ := NewHandler(costState())
+
+	r := httptest.NewRequest("GET", "/range/list?%25b", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if header := w.Header().Get("RangeCost"); header != "4" {
+		t.Errorf("RangeCost = %q, expected 4", header)
+	}
+}
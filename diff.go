@@ -0,0 +1,63 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A QueryDiff is the change in a query's result between two states. Added
+// and Removed are compressed as by Compress, and are empty if no values were
+// added or removed.
+type QueryDiff struct {
+	Query   string
+	Added   string
+	Removed string
+
+	// Set if the query could not be evaluated against either state, in which
+	// case Added and Removed are empty.
+	Err error
+}
+
+// Changed reports whether the query's result changed.
+func (d QueryDiff) Changed() bool {
+	return d.Added != "" || d.Removed != "" || d.Err != nil
+}
+
+// DiffQueries evaluates each query against both states and reports how the
+// results differ, such as to check which saved queries a change to cluster
+// definitions would affect before rolling it out. AffectedKeys can be used to
+// find which cluster keys to look at.
+func DiffQueries(oldState *State, newState *State, queries []string) []QueryDiff {
+	diffs := []QueryDiff{}
+	for _, query := range queries {
+		diffs = append(diffs, diffQuery(oldState, newState, query))
+	}
+	return diffs
+}
+
+func diffQuery(oldState *State, newState *State, query string) QueryDiff {
+	diff := QueryDiff{Query: query}
+
+	before, err := oldState.Query(query)
+	if err != nil {
+		diff.Err = errors.New(fmt.Sprintf("Old state: %s", err))
+		return diff
+	}
+	after, err := newState.Query(query)
+	if err != nil {
+		diff.Err = errors.New(fmt.Sprintf("New state: %s", err))
+		return diff
+	}
+
+	added := Result{after.Difference(before.Set)}
+	removed := Result{before.Difference(after.Set)}
+	if diff.Added, err = Compress(&added); err != nil {
+		diff.Err = err
+	} else if diff.Removed, err = Compress(&removed); err != nil {
+		diff.Err = err
+	}
+	if diff.Err != nil {
+		diff.Added, diff.Removed = "", ""
+	}
+	return diff
+}
@@ -0,0 +1,32 @@
+package grange
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffQueries(t *testing.T) {
+	old := NewState()
+	old.AddCluster("a", Cluster{"CLUSTER": []string{"web1..3", "db1"}})
+	old.AddCluster("b", Cluster{"CLUSTER": []string{"x"}})
+
+	updated := NewState()
+	updated.AddCluster("a", Cluster{"CLUSTER": []string{"web2..5", "db1"}})
+	updated.AddCluster("b", Cluster{"CLUSTER": []string{"x", "%c"}})
+
+	diffs := DiffQueries(&old, &updated, []string{"%a", "%b", "%a - db1", "%a,"})
+	expected := []QueryDiff{
+		{"%a", "web4..5", "web1", nil},
+		{"%b", "", "", nil},
+		{"%a - db1", "web4..5", "web1", nil},
+	}
+	if !reflect.DeepEqual(diffs[:3], expected) {
+		t.Errorf("DiffQueries\n got: %v\nwant: %v", diffs[:3], expected)
+	}
+	if diffs[1].Changed() || !diffs[0].Changed() {
+		t.Errorf("Unexpected Changed for %v", diffs[:2])
+	}
+	if diffs[3].Err == nil || !diffs[3].Changed() {
+		t.Errorf("Expected error for invalid query, got %v", diffs[3])
+	}
+}
@@ -0,0 +1,195 @@
+package grange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/v1/yaml"
+)
+
+// LoadDir builds a state from a directory containing one file per cluster,
+// in the same format as range-spec. Each file is named after its cluster, such
+// as dc1.yaml, and maps keys to either a single value or a list of values.
+// Files with .yaml, .yml and .json extensions are loaded, except those
+// starting with a dot, such as editor swap files. Everything else is ignored.
+//
+// Values that are not strings, numbers or booleans are discarded.
+func LoadDir(dir string) (State, error) {
+	state := NewState()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return state, err
+	}
+
+	for _, path := range paths {
+		name, c, err := loadClusterFile(path)
+		if err != nil {
+			return state, err
+		}
+		if c != nil {
+			state.AddCluster(name, c)
+		}
+	}
+	return state, nil
+}
+
+// DirSource is a ClusterSource that reads clusters from a directory in the
+// same format as LoadDir, one file at a time as they are needed.
+type DirSource struct {
+	dir string
+}
+
+var clusterExtensions = []string{".yaml", ".yml", ".json"}
+
+// NewDirSource returns a source reading from dir.
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir}
+}
+
+func (s *DirSource) Get(name string) (Cluster, error) {
+	// Cluster names come from queries, so must not be able to refer to files
+	// outside the directory.
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, nil
+	}
+
+	for _, ext := range clusterExtensions {
+		_, c, err := loadClusterFile(filepath.Join(s.dir, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		return c, err
+	}
+	return nil, nil
+}
+
+func (s *DirSource) List() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	names := []string{}
+	for _, path := range paths {
+		name := clusterFileName(path)
+		if isClusterFile(path) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Watch returns nil, DirSource does not detect changes.
+func (s *DirSource) Watch() <-chan string {
+	return nil
+}
+
+// isClusterFile reports whether a file in a cluster directory defines a
+// cluster, the same files being used by LoadDir, DirSource and WatchDir.
+func isClusterFile(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+
+	ext := filepath.Ext(path)
+	for _, e := range clusterExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a nil cluster for files that are not cluster definitions.
+func loadClusterFile(path string) (string, Cluster, error) {
+	name := clusterFileName(path)
+	if !isClusterFile(path) {
+		return name, nil, nil
+	}
+
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return name, nil, err
+	}
+	return parseClusterFile(path, dat)
+}
+
+// clusterFileName returns the name of the cluster defined by a file.
+func clusterFileName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// parseClusterFile parses the contents of a cluster file, in the format given
+// by its extension.
+func parseClusterFile(path string, dat []byte) (string, Cluster, error) {
+	name := clusterFileName(path)
+
+	var unmarshal func([]byte, interface{}) error
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".json":
+		unmarshal = json.Unmarshal
+	default:
+		return name, nil, nil
+	}
+
+	m := make(map[string]interface{})
+	if err := unmarshal(dat, &m); err != nil {
+		return name, nil, errors.New(fmt.Sprintf("Invalid cluster file %s: %s", path, err))
+	}
+	return name, toCluster(m), nil
+}
+
+// Converts a generic YAML or JSON map to a cluster by extracting all the
+// correctly typed strings and discarding invalid values.
+func toCluster(m map[string]interface{}) Cluster {
+	c := Cluster{}
+
+	for key, value := range m {
+		switch value.(type) {
+		case nil:
+			c[key] = []string{}
+		case []interface{}:
+			result := []string{}
+
+			for _, x := range value.([]interface{}) {
+				if s, ok := toValue(x); ok {
+					result = append(result, s)
+				}
+			}
+			c[key] = result
+		default:
+			if s, ok := toValue(value); ok {
+				c[key] = []string{s}
+			}
+		}
+	}
+	return c
+}
+
+func toValue(x interface{}) (string, bool) {
+	switch x.(type) {
+	case string:
+		return x.(string), true
+	case int:
+		return strconv.Itoa(x.(int)), true
+	case int64:
+		return strconv.FormatInt(x.(int64), 10), true
+	case float64:
+		return strconv.FormatFloat(x.(float64), 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(x.(bool)), true
+	default:
+		return "", false
+	}
+}
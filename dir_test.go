@@ -0,0 +1,38 @@
+package grange
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte("CLUSTER: [x, 1, true]\nB: z\nC:\nD: {e: f}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"CLUSTER": [1.5, 2], "E": null}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("ignored"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".a.yaml.swp.yaml"), []byte("CLUSTER: [ignored]\n"), 0644)
+
+	state, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir returned error: %s", err)
+	}
+
+	testEval(t, NewResult("x", "1", "true"), "%a", &state)
+	testEval(t, NewResult("z"), "%a:B", &state)
+	testEval(t, NewResult("B", "C", "CLUSTER"), "%a:KEYS", &state)
+	testEval(t, NewResult("1.5", "2"), "%b", &state)
+	testEval(t, NewResult("a", "b"), "clusters(x,2)", &state)
+	testEval(t, NewResult("a", "b"), "allclusters()", &state)
+
+	ioutil.WriteFile(filepath.Join(dir, "d.json"), []byte(`[1]`), 0644)
+	if _, err := LoadDir(dir); err == nil {
+		t.Errorf("Expected error for invalid cluster file")
+	}
+}
@@ -29,6 +29,89 @@ of each other ("self-referential").
 
     result, err := state.Query("%dc1")  // "host2"
 
+By default, queries are case sensitive and identifiers are limited to ASCII.
+Both can be changed per-state:
+
+    state.SetCaseInsensitive(true)   // %DC1 is %dc1, WEB1 & web1 is web1
+    state.SetUnicodeIdentifiers(true) // %café is a valid cluster lookup
+
+States can also be loaded from a directory of YAML or JSON files with
+LoadDir, and served over HTTP to existing libcrange clients with Handler:
+
+    state, err := grange.LoadDir("clusters")
+    handler, errs := grange.NewHandler(&state)
+    http.ListenAndServe(":8080", handler) // GET /range/list?%25dc1
+
+Rather than adding every cluster up front, a state can load clusters lazily
+from a ClusterSource, such as a DirSource or SQLiteSource. Loaded clusters do
+not change until they are reloaded, so queries stay deterministic:
+
+    state.SetSource(source)
+    for name := range source.Watch() {
+      state.Reload(name)
+    }
+
+A directory of cluster files can also be watched with WatchDir, which applies
+each change to the state as it happens. Changes only discard the cached
+values they affect, and may be made while a primed state is being queried:
+
+    state, _ := grange.LoadDir("clusters")
+    state.PrimeCache()
+    watcher := grange.WatchDir("clusters", &state, func(err error) {
+      log.Println(err) // the last good version of the cluster is kept
+    })
+
+With SetHistory, a state keeps previous versions of its clusters, so that
+queries can be answered as they would have been in the past:
+
+    state.SetHistory(1000, 7*24*time.Hour)
+    result, err := state.QueryAsOf(yesterday, "%web-prod")
+    version, err := state.VersionAt(yesterday)
+    changes, err := state.Diff(version, state.Version())
+
+Before rolling out a change to cluster definitions, DiffQueries shows how the
+results of saved queries would change, and AffectedKeys which keys could be
+affected by the change:
+
+    for _, diff := range grange.DiffQueries(&current, &proposed, queries) {
+      if diff.Changed() {
+        fmt.Printf("%s: +%s -%s\n", diff.Query, diff.Added, diff.Removed)
+      }
+    }
+
+References between clusters are found by parsing their values. ReferencesTo
+and DependenciesOf list them for a single cluster, and Graph for every
+cluster, which can be rendered with Graphviz:
+
+    graph, err := state.Graph()
+    graph.WriteDOT(os.Stdout) // dot -Tsvg
+
+Services that issue the same queries over and over can also cache the
+results of their subexpressions, such as has(TYPE;redis), which are discarded
+whenever clusters change:
+
+    state.SetMemoLimit(64 << 20) // bytes
+    stats := state.MemoStats()   // stats.HitRate()
+
+Why explains how a value came to be in a result, or what removed it:
+
+    derivation, err := state.Why("%{has(TYPE;redis)}:DOWN - %down", "host42")
+    fmt.Println(derivation)
+
+To monitor a state, set an Observer to receive events such as queries, cache
+hits and misses, and truncated results. ExpvarObserver counts them in an
+expvar map, served from /debug/vars:
+
+    state.SetObserver(grange.NewExpvarObserver("grange"))
+
+QueryCost reports the work a query did, counting expressions evaluated,
+cluster keys looked up, regex matches and brace products, and aborts it with
+a *CostError once it exceeds a budget. Query uses MaxQueryCost, which is
+unlimited by default:
+
+    result, cost, err := state.QueryCost("%{has(TYPE;redis)}", 10000)
+    fmt.Println(cost.Total())
+
 For an example usage of this library, see
 https://github.com/xaviershay/grange-server
 
@@ -36,14 +119,26 @@ Syntax
 
     host1         - value constant, returns itself.
     host1,host2   - union, concatenates both sides.
-    host1..3      - numeric expansion.
+    host1..3      - numeric expansion. host1..host3 is the same, but host1..db3
+                    is an error.
+    host1..9/2    - numeric expansion with a step, returns host1,host3,...,host9.
+    host3..1      - descending ranges expand the same as host1..3.
+    r1..2-h1..3   - multiple ranges in one value expand to every combination,
+                    like brace expansion: r1-h1,r1-h2,...,r2-h3.
+    node0x0a..0x1f
+                  - hex expansion, padded to the width and case of the left
+                    side.
     a{b,c}d       - brace expansion, works just like your shell.
     (a,b) & a     - returns intersection of boths sides.
     (a,b) - a     - returns left side minus right side.
+    (a,b) ^ (b,c) - symmetric difference, returns values in exactly one side.
     /abc/         - regex match using RE2 semantics. When used on the right
                     side of an operator, filters the left side values using the
                     regex.  When used by itself, matches all values in the
                     default cluster..
+    !%down        - complement, returns all values in the default cluster
+                    that are not in %down. The universe can be restricted to
+                    a single key of the default cluster with SetUniverseKey.
     %dc1          - cluster lookup, returns the values at CLUSTER key in "dc1"
                     cluster.
     %dc1:KEYS     - returns all available keys for a cluster.
@@ -57,12 +152,56 @@ Syntax
     ?host1        - returns all keys in the default cluster that contain host1.
     clusters(h1)  - returns all clusters for which the h1 is present in the
                     CLUSTER key. Parameter can be any range expression.
-    has(KEY;val)  - returns all clusters with SOMEKEY matching value.
+    has(KEY;val)  - returns all clusters with SOMEKEY matching value. If KEY
+                    returns multiple keys, clusters matching on any of them are
+                    returned. val may be a regex, such as has(TYPE;/redis/).
+    hasall(KEYS;val)
+                  - like has, but clusters must match on every key.
+    hasnot(KEY;val)
+                  - returns all clusters not matched by has(KEY;val).
+    lacks(KEY)    - returns all clusters that do not define any of KEY.
     count(EXPR)   - returns the number of results returned by EXPR.
     allclusters() - returns the names of all clusters
+    refs(NAME)    - returns the other clusters whose values refer to NAME,
+                    such as with %NAME or @NAME. An optional second parameter
+                    restricts this to keys of NAME, as in refs(dc1;DOWN).
+    deps(NAME)    - returns the clusters that NAME's values refer to. An
+                    optional second parameter restricts this to keys of NAME.
+    not(EXPR)     - equivalent to !EXPR.
+    sub(EXPR;/re/;repl)
+                  - replaces matches of the regex in each value of EXPR with
+                    repl, which may reference capture groups as ${1}. Use q()
+                    for replacements that are not plain values.
+    extract(EXPR;/re/)
+                  - the first capture group of the regex in each value of
+                    EXPR, or the whole match if there are no groups. Values
+                    that do not match are dropped.
+    extract(EXPR;/re/;name)
+                  - as above, but returns the named group (?P<name>...).
+    prefix(EXPR;p)
+    suffix(EXPR;s)
+                  - prepends p (or appends s) to each value of EXPR.
+    shortname(EXPR)
+                  - the portion of each value before the first ".".
+    domain(EXPR)  - the portion of each value after the first ".". Values
+                    without a domain are dropped.
+    lower(EXPR)   - lowercases each value.
     q(x://blah)   - quote a constant value, the parameter will be returned as
                     is and not evaluated as a range expression. Useful for
                     storing metadata in clusters.
+    "x://blah"    - a string constant. Supports the same backslash escapes
+                    as Go string literals, such as \", \\, \n and \u00e9, so
+                    unlike q() can represent any value. Compress uses this
+                    form for values that are not valid range literals.
+    'x://blah'    - a raw string constant. Backslashes have no special
+                    meaning, but it cannot contain '.
+
+As in libcrange, binary operators and brace expansion all have the same
+precedence and are left associative. Brackets can be used to override this.
+
+    a , b & c     - same as (a , b) & c
+    a - b , c     - same as (a - b) , c
+    x , a{b,c}    - same as (x , a){b,c}
 
 All of the above can be combined to form highly expressive queries.
 
@@ -75,13 +214,17 @@ All of the above can be combined to form highly expressive queries.
     %{clusters(/foo/)}:{DOC,OWNER}
         - OWNER and DOC values for all clusters on all hosts matching "foo".
 
+    sub(%dc1;/^([^.]+)/;q(${1}-ilo))
+        - the ILO interface names for all hosts in dc1.
+
 Differences From Libcrange
 
 A number of libcrange features have been deliberately omitted from grange,
 either becase they are archaic features of the language, or they are
 mis-aligned with the goals of this library.
 
-    - ^ "admin" operator is not supported. Not a useful concept anymore.
+    - ^ "admin" operator is not supported. Not a useful concept anymore. ^ is
+      symmetric difference instead.
     - # "hash" operator is not supported. Normal function calls are sufficient.
     - Uses RE2 regular expressions rather than PCRE. RE2 is not as fully
       featured, but guarantees that searches run in time linear in the size of
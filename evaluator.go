@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"gopkg.in/deckarep/v1/golang-set"
 )
@@ -21,10 +24,108 @@ import (
 type State struct {
 	clusters       map[string]Cluster
 	defaultCluster string
+	universeKey    string
+
+	caseInsensitive    bool
+	unicodeIdentifiers bool
+
+	// Clusters loaded from source, and names it does not have. See SetSource.
+	// Queries load clusters while only holding mutex for reading, so loading
+	// is serialized by sourceMutex.
+	source      ClusterSource
+	loaded      map[string]bool
+	missing     map[string]bool
+	listed      bool
+	sourceMutex *sync.Mutex
+
+	// Incremented by every change to clusters. See SetHistory.
+	version uint64
+	history *history
+
+	// Results of subexpressions of queries, if enabled. See SetMemoLimit.
+	memo *memo
+
+	// The references in every cluster's values, parsed when first needed and
+	// discarded whenever clusters change. Queries fill it while only holding
+	// mutex for reading, so it is guarded by refsMutex. See references.
+	refs      []Reference
+	refsMutex *sync.Mutex
+
+	observer Observer
 
 	// Populated lazily as groups are evaluated. They won't change unless state
 	// changes.
-	clusterCache map[string]map[string]*Result
+	clusterCache map[string]map[string]*cacheEntry
+	primed       bool
+
+	// The dependencies of each cache entry being computed, innermost last.
+	recording []*dependencies
+
+	// Held for reading by queries and for writing by changes to clusters. A
+	// pointer, since states are passed around by value.
+	mutex *sync.RWMutex
+}
+
+// A cached expansion of a cluster key, and the clusters it was computed from.
+type cacheEntry struct {
+	result *Result
+	deps   *dependencies
+}
+
+// dependencies are the clusters that a cached value was computed from. Every
+// cluster is a dependency of functions such as allclusters().
+type dependencies struct {
+	all   bool
+	names map[string]bool
+}
+
+func newDependencies(names ...string) *dependencies {
+	deps := &dependencies{names: map[string]bool{}}
+	for _, name := range names {
+		deps.names[name] = true
+	}
+	return deps
+}
+
+func (deps *dependencies) has(name string) bool {
+	return deps.all || deps.names[name]
+}
+
+func (deps *dependencies) merge(other *dependencies) {
+	deps.all = deps.all || other.all
+	for name := range other.names {
+		deps.names[name] = true
+	}
+}
+
+// recordInto runs f, adding the clusters it uses to deps. The clusters are
+// also added to any dependencies already being recorded, since a value that
+// uses another cached value depends on the same clusters.
+func (state *State) recordInto(deps *dependencies, f func() error) error {
+	state.recording = append(state.recording, deps)
+	defer func() {
+		state.recording = state.recording[:len(state.recording)-1]
+		state.recordDependencies(deps)
+	}()
+	return f()
+}
+
+func (state *State) recordDependencies(deps *dependencies) {
+	if len(state.recording) > 0 {
+		state.recording[len(state.recording)-1].merge(deps)
+	}
+}
+
+func (state *State) recordCluster(name string) {
+	if len(state.recording) > 0 {
+		state.recording[len(state.recording)-1].names[name] = true
+	}
+}
+
+func (state *State) recordAll() {
+	if len(state.recording) > 0 {
+		state.recording[len(state.recording)-1].all = true
+	}
 }
 
 // A Cluster is mapping of arbitrary keys to arrays of values. The only
@@ -55,14 +156,19 @@ var (
 	// expensive queries. This should not be exceeded in normal operation.
 	MaxQueryDepth = 100
 
+	// The default budget for the cost of a query, see QueryCost. Unlike
+	// MaxQueryDepth, this bounds the total work done by a query, however
+	// flat. Zero means no limit.
+	MaxQueryCost = 0
+
 	// The default cluster for new states, used by @ and ? syntax. Can be changed
 	// per-state using SetDefaultCluster.
 	DefaultCluster = "GROUPS"
 )
 
-// Clusters is a getter for all clusters that have been added to the state.
-// There isn't really a good reason to use this other than for debugging
-// purposes.
+// Clusters is a getter for all clusters that have been added to the state,
+// including those loaded from its source so far. There isn't really a good
+// reason to use this other than for debugging purposes.
 func (s *State) Clusters() map[string]Cluster {
 	return s.clusters
 }
@@ -73,6 +179,11 @@ func NewState() State {
 	state := State{
 		clusters:       map[string]Cluster{},
 		defaultCluster: DefaultCluster,
+		loaded:         map[string]bool{},
+		missing:        map[string]bool{},
+		mutex:          &sync.RWMutex{},
+		sourceMutex:    &sync.Mutex{},
+		refsMutex:      &sync.Mutex{},
 	}
 	state.ResetCache()
 	return state
@@ -84,15 +195,144 @@ func NewResult(args ...interface{}) Result {
 	return Result{mapset.NewSetFromSlice(args)}
 }
 
-// AddCluster adds a new cluster to the state and resets the cache.
+// AddCluster adds or replaces a cluster. Only cached values that were
+// computed from the cluster are discarded, and if the cache was primed they
+// are recomputed, so it is safe to call while queries are running on a
+// primed state.
 func (state *State) AddCluster(name string, c Cluster) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.caseInsensitive {
+		name, c = state.fold(name), c.fold()
+	}
 	state.clusters[name] = c
+	delete(state.loaded, name)
+	delete(state.missing, name)
+	state.update(name)
+	state.record(name, c)
+}
+
+// RemoveCluster removes a cluster, discarding cached values the same way as
+// AddCluster.
+func (state *State) RemoveCluster(name string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	name = state.fold(name)
+	delete(state.clusters, name)
+	delete(state.loaded, name)
+	state.update(name)
+	state.record(name, nil)
+}
+
+// SetCaseInsensitive changes whether the state ignores case. When enabled,
+// cluster names, keys and values are all lowercased, both in clusters that
+// have been added and in queries, so %DC1 and %dc1 refer to the same cluster
+// and WEB1 & web1 returns web1. Regexes also match case-insensitively.
+// Constants such as q(Some Text) are returned as is, but are compared ignoring
+// case by operators and functions such as has(), and results never contain
+// two values that differ only in case: the first one added is kept.
+//
+// Clusters whose names differ only in case, such as Web and web, are merged
+// into one, as are keys within a cluster.
+func (state *State) SetCaseInsensitive(on bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.caseInsensitive = on
+
+	if on {
+		// Merged in order of name, so that the values of merged keys are
+		// always in the same order.
+		names := []string{}
+		for name := range state.clusters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		clusters := map[string]Cluster{}
+		loaded := map[string]bool{}
+		for _, name := range names {
+			folded, c := state.fold(name), state.clusters[name].fold()
+			if existing, ok := clusters[folded]; ok {
+				for key, values := range c {
+					existing[key] = append(existing[key], values...)
+				}
+				// Only reloaded from the source if all of it came from there.
+				loaded[folded] = loaded[folded] && state.loaded[name]
+			} else {
+				clusters[folded] = c
+				loaded[folded] = state.loaded[name]
+			}
+		}
+		state.clusters = clusters
+		state.loaded = loaded
+	}
+	state.missing = map[string]bool{}
+	state.listed = false
 	state.ResetCache()
 }
 
+// SetUnicodeIdentifiers changes whether queries may contain unicode letters
+// in cluster names, keys, functions and values, such as %café. Otherwise only
+// ASCII is allowed, and other values need to be quoted.
+func (state *State) SetUnicodeIdentifiers(on bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.unicodeIdentifiers = on
+	state.resetReferences()
+}
+
+// fold returns the canonical form of a name when the state is case
+// insensitive.
+func (state *State) fold(name string) string {
+	if state.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// fold returns a copy of the cluster with lowercased keys. Values are folded
+// as they are evaluated, since lowercasing an expression could change its
+// meaning.
+func (c Cluster) fold() Cluster {
+	keys := []string{}
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	folded := Cluster{}
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		folded[lower] = append(folded[lower], c[key]...)
+	}
+	return folded
+}
+
 // Changes the default cluster for the state.
 func (state *State) SetDefaultCluster(name string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
 	state.defaultCluster = name
+	state.resetReferences()
+	state.memo.reset()
+}
+
+// SetUniverseKey changes the set of values that complements (!expr) are taken
+// relative to. By default this is every value in the default cluster; when a
+// key is set, only the values at that key in the default cluster are used.
+// Pass an empty string to restore the default.
+func (state *State) SetUniverseKey(key string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.universeKey = key
+	state.resetReferences()
+	state.memo.reset()
 }
 
 // PrimeCache traverses over the entire state to expand all values and store
@@ -103,28 +343,90 @@ func (state *State) SetDefaultCluster(name string) {
 // necessarily a critical problem, often errors will be in obscure keys, but
 // you should probably try to fix them.
 func (state *State) PrimeCache() []error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
 	errors := []error{}
 
+	clusters, err := state.allClusters()
+	if err != nil {
+		return append(errors, err)
+	}
+
+	total, done := 0, 0
+	for _, cluster := range clusters {
+		total += len(cluster)
+	}
+
 	// TODO: See if this is faster if parrelized (need to add coordination to
 	// cache).
-	for name, cluster := range state.clusters {
-		context := newContext()
-		context.currentClusterName = name
+	for name, cluster := range clusters {
 		for key, _ := range cluster {
-			err := clusterLookup(state, &context, key)
-			if err != nil {
+			if err := state.prime(name, key); err != nil {
 				errors = append(errors, err)
 			}
+			done++
+			if state.observer != nil {
+				state.observer.PrimeProgress(done, total)
+			}
 		}
 	}
+	state.primed = true
 	return errors
 }
 
+func (state *State) prime(name string, key string) error {
+	context := state.newContext()
+	context.currentClusterName = name
+	context.currentResult = NewResult()
+	return clusterLookup(state, &context, key)
+}
+
 // ResetCache clears cached expansions. The public API for modifying state
 // already calls this when necessary, so you shouldn't really have a need to
 // call this.
 func (state *State) ResetCache() {
-	state.clusterCache = map[string]map[string]*Result{}
+	state.clusterCache = map[string]map[string]*cacheEntry{}
+	state.primed = false
+	state.resetReferences()
+	state.memo.reset()
+}
+
+// update discards cached values computed from the named cluster after it has
+// changed. If the cache was primed, they are recomputed so that it stays
+// primed.
+func (state *State) update(name string) {
+	state.resetReferences()
+	stale := state.invalidate(name)
+	if !state.primed {
+		return
+	}
+
+	// Errors are reported when the cluster is queried.
+	c, _ := state.cluster(name)
+	for key := range c {
+		stale = append(stale, [2]string{name, key})
+	}
+	for _, entry := range stale {
+		if c, _ := state.cluster(entry[0]); c[entry[1]] != nil {
+			state.prime(entry[0], entry[1])
+		}
+	}
+}
+
+// invalidate discards cached values computed from the named cluster,
+// returning the cluster and key of each.
+func (state *State) invalidate(name string) [][2]string {
+	stale := [][2]string{}
+	for clusterName, entries := range state.clusterCache {
+		for key, entry := range entries {
+			if entry.deps.has(name) {
+				delete(entries, key)
+				stale = append(stale, [2]string{clusterName, key})
+			}
+		}
+	}
+	return stale
 }
 
 // Query is the main interface to grange. See the main package documentation
@@ -132,18 +434,39 @@ func (state *State) ResetCache() {
 // alongside the error. Queries that are longer than MaxQuerySize are
 // considered errors.
 //
-// The size of the returned result is capped by MaxResults.
+// The size of the returned result is capped by MaxResults, and the work done
+// to compute it by MaxQueryCost, see QueryCost.
 //
 // This method is only thread-safe if PrimeCache() has previously been called
 // on the state.
 func (state *State) Query(input string) (Result, error) {
+	result, _, err := state.QueryCost(input, 0)
+	return result, err
+}
+
+func (state *State) query(input string, meter *costMeter) (Result, error) {
 	if len(input) > MaxQuerySize {
 		return NewResult(),
 			errors.New(fmt.Sprintf("Query is too long, max length is %d", MaxQuerySize))
 	}
 
-	context := newContext()
-	return evalRangeWithContext(input, state, &context)
+	context := state.newContext()
+	context.cost = meter
+
+	node, err := parseRange(input, state.unicodeIdentifiers)
+	if err != nil {
+		return NewResult(), err
+	}
+	if state.memo != nil {
+		node = memoize(node)
+	}
+	if err = evalNodeInplace(node, state, &context); err == nil {
+		err = context.costErr()
+	}
+	if err != nil {
+		return NewResult(), err
+	}
+	return context.currentResult, nil
 }
 
 type tooManyResults struct{}
@@ -153,19 +476,37 @@ type evalContext struct {
 	currentResult      Result
 	workingResult      *Result
 	depth              int
+	foldCase           bool
+	cost               *costMeter
+
+	// The lowercased values of currentResult, when foldCase is set.
+	folded map[string]bool
 }
 
 func newContext() evalContext {
 	return evalContext{currentResult: NewResult()}
 }
 
-func parseRange(input string) (parserNode, error) {
-	r := &rangeQuery{Buffer: input}
+func (state *State) newContext() evalContext {
+	context := newContext()
+	context.foldCase = state.caseInsensitive
+	return context
+}
+
+func parseRange(input string, unicode bool) (parserNode, error) {
+	r := &rangeQuery{Buffer: input, unicode: unicode}
 	r.Init()
 	if err := r.Parse(); err != nil {
-		return nil, err
+		offset := 0
+		if e, ok := err.(*parseError); ok {
+			offset = int(e.max.end)
+		}
+		return nil, &ParseError{input, offset}
 	}
 	r.Execute()
+	if r.err != nil {
+		return nil, r.err
+	}
 	if len(r.nodeStack) > 0 {
 		return r.nodeStack[0], nil
 	} else {
@@ -180,21 +521,33 @@ func evalRangeWithContext(input string, state *State, context *evalContext) (Res
 }
 
 // Useful internally so that results do not need to be copied all over the place
-func evalRangeInplace(input string, state *State, context *evalContext) (err error) {
+func evalRangeInplace(input string, state *State, context *evalContext) error {
 	if context.depth > MaxQueryDepth {
+		if state.observer != nil {
+			state.observer.RecursionLimit(input)
+		}
 		return errors.New("Query exceeded maximum recursion limit")
 	}
-	node, parseError := parseRange(input)
+	node, parseError := parseRange(input, state.unicodeIdentifiers)
 	if parseError != nil {
-		return errors.New("Could not parse query: " + input)
+		return parseError
 	}
 
+	return evalNodeInplace(node, state, context)
+}
+
+// evalNodeInplace evaluates a parsed node, truncating the results rather than
+// failing if there are too many.
+func evalNodeInplace(node parserNode, state *State, context *evalContext) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			switch r.(type) {
 			case tooManyResults:
 				// No error returned, we just chop off the results
 				err = nil
+				if state.observer != nil {
+					state.observer.Truncated(node.String())
+				}
 			case error:
 				err = r.(error)
 			default:
@@ -211,6 +564,8 @@ func (c evalContext) hasResults() bool {
 }
 
 func (n nodeBraces) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
 	leftContext := context.sub()
 	rightContext := context.sub()
 	middleContext := context.sub()
@@ -229,6 +584,9 @@ func (n nodeBraces) visit(state *State, context *evalContext) error {
 		rightContext.addResult("")
 	}
 
+	context.charge(costProduct, leftContext.currentResult.Cardinality()*
+		middleContext.currentResult.Cardinality()*rightContext.currentResult.Cardinality())
+
 	for l := range leftContext.resultIter() {
 		for m := range middleContext.resultIter() {
 			for r := range rightContext.resultIter() {
@@ -241,10 +599,13 @@ func (n nodeBraces) visit(state *State, context *evalContext) error {
 }
 
 func (n nodeLocalClusterLookup) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
 	return clusterLookup(state, context, n.key)
 }
 
 func (n nodeClusterLookup) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
 	var evalErr error
 
 	subContext := context.sub()
@@ -272,10 +633,33 @@ func (n nodeClusterLookup) visit(state *State, context *evalContext) error {
 	return nil
 }
 
+func (n nodeComplement) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
+	universeContext := context.sub()
+	if err := state.universe(&universeContext); err != nil {
+		return err
+	}
+
+	subContext := context.sub()
+	// nodeRegexp needs to know about the universe to filter correctly
+	subContext.workingResult = &universeContext.currentResult
+	if err := n.node.(evalNode).visit(state, &subContext); err != nil {
+		return err
+	}
+
+	for x := range universeContext.currentResult.Difference(subContext.currentResult.Set).Iter() {
+		context.addResult(x.(string))
+	}
+	return nil
+}
+
 func (c evalContext) sub() evalContext {
 	ret := newContext()
 	ret.currentClusterName = c.currentClusterName
 	ret.depth = c.depth + 1
+	ret.foldCase = c.foldCase
+	ret.cost = c.cost
 	return ret
 }
 
@@ -286,6 +670,8 @@ func (c evalContext) subCluster(clusterName string) evalContext {
 }
 
 func (n nodeOperator) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
 	switch n.op {
 	case operatorIntersect:
 
@@ -302,8 +688,11 @@ func (n nodeOperator) visit(state *State, context *evalContext) error {
 		rightContext.workingResult = &leftContext.currentResult
 		n.right.(evalNode).visit(state, &rightContext) // TODO: Error handle
 
-		for x := range leftContext.currentResult.Intersect(rightContext.currentResult.Set).Iter() {
-			context.addResult(x.(string))
+		inRight := context.contains(rightContext.currentResult)
+		for x := range leftContext.resultIter() {
+			if inRight(x.(string)) {
+				context.addResult(x.(string))
+			}
 		}
 	case operatorSubtract:
 		leftContext := context.sub()
@@ -319,40 +708,199 @@ func (n nodeOperator) visit(state *State, context *evalContext) error {
 		rightContext.workingResult = &leftContext.currentResult
 		n.right.(evalNode).visit(state, &rightContext) // TODO: Error handle
 
-		for x := range leftContext.currentResult.Difference(rightContext.currentResult.Set).Iter() {
-			context.addResult(x.(string))
+		inRight := context.contains(rightContext.currentResult)
+		for x := range leftContext.resultIter() {
+			if !inRight(x.(string)) {
+				context.addResult(x.(string))
+			}
 		}
 	case operatorUnion:
 		// TODO: Handle errors
 		n.left.(evalNode).visit(state, context)
 		n.right.(evalNode).visit(state, context)
+	case operatorSymmetricDifference:
+		leftContext := context.sub()
+		if err := n.left.(evalNode).visit(state, &leftContext); err != nil {
+			return err
+		}
+
+		rightContext := context.sub()
+		if err := n.right.(evalNode).visit(state, &rightContext); err != nil {
+			return err
+		}
+
+		inLeft := context.contains(leftContext.currentResult)
+		inRight := context.contains(rightContext.currentResult)
+		for x := range leftContext.resultIter() {
+			if !inRight(x.(string)) {
+				context.addResult(x.(string))
+			}
+		}
+		for x := range rightContext.resultIter() {
+			if !inLeft(x.(string)) {
+				context.addResult(x.(string))
+			}
+		}
 	}
 	return nil
 }
 
 func (n nodeConstant) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
 	context.addResult(n.val)
 	return nil
 }
 
 var (
-	numericRangeRegexp = regexp.MustCompile("^(.*?)(\\d+)\\.\\.([^\\d]*?)?(\\d+)(.*)$")
+	numericRangeRegexp = regexp.MustCompile("^(.*?)(\\d+)\\.\\.([^\\d]*?)?(\\d+)(/\\d+)?(.*)$")
+	hexRangeRegexp     = regexp.MustCompile("^(.*?)(0[xX])([[:xdigit:]]+)\\.\\.([^\\d]*?)0[xX]([[:xdigit:]]+)(/\\d+)?(.*)$")
+
+	// Compiled regexes are shared across evaluations, since the same handful
+	// of patterns tend to be used over and over. The cache is emptied if it
+	// grows past maxCachedRegexps.
+	regexpCache      = map[string]*regexp.Regexp{}
+	regexpCacheMutex sync.Mutex
+	maxCachedRegexps = 1000
 )
 
+// compileRegexp compiles a regex, matching case-insensitively if the context
+// is.
+func (c *evalContext) compileRegexp(expr string) (*regexp.Regexp, error) {
+	if c.foldCase {
+		expr = "(?i)" + expr
+	}
+	return compileRegexp(expr)
+}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	regexpCacheMutex.Lock()
+	defer regexpCacheMutex.Unlock()
+
+	if r, ok := regexpCache[expr]; ok {
+		return r, nil
+	}
+
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(regexpCache) >= maxCachedRegexps {
+		regexpCache = map[string]*regexp.Regexp{}
+	}
+	regexpCache[expr] = r
+	return r, nil
+}
+
 func (n nodeText) visit(state *State, context *evalContext) error {
-	match := numericRangeRegexp.FindStringSubmatch(n.val)
+	context.charge(costNode, 1)
 
-	if len(match) == 0 {
-		context.addResult(n.val)
-		return nil
+	if context.foldCase {
+		n.val = strings.ToLower(n.val)
+	}
+
+	ranges, trailing, err := parseNumericRanges(n.val)
+	if err != nil {
+		return err
+	}
+
+	expandNumericRanges(context, "", ranges, trailing)
+	return nil
+}
+
+// A numericRange is one dimension of a numeric expansion, along with the text
+// preceding it. r1..4-h1..20 has two: "r" 1..4 and "-h" 1..20.
+type numericRange struct {
+	prefix string
+	format string
+	low    int64
+	high   int64
+	step   int64
+}
+
+func parseNumericRanges(val string) ([]numericRange, string, error) {
+	ranges := []numericRange{}
+	rest := val
+
+	for {
+		var r numericRange
+		var err error
+
+		// Use whichever range starts first. A hex range starts at its 0x
+		// marker, so wins a tie with a decimal range starting at the 0.
+		hexMatch := hexRangeRegexp.FindStringSubmatch(rest)
+		match := numericRangeRegexp.FindStringSubmatch(rest)
+
+		if len(hexMatch) > 0 && (len(match) == 0 || len(hexMatch[1]) <= len(match[1])) {
+			r, rest, err = parseHexRange(val, hexMatch)
+		} else if len(match) > 0 {
+			r, rest, err = parseDecimalRange(val, match)
+		} else {
+			break
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+		ranges = append(ranges, r)
+	}
+
+	if strings.Contains(rest, "/") {
+		return nil, "", errors.New(fmt.Sprintf("Range step without a range: %s", val))
+	}
+	return ranges, rest, nil
+}
+
+// Expands ranges as a cross product, like brace expansion does.
+func expandNumericRanges(context *evalContext, prefix string, ranges []numericRange, trailing string) {
+	if len(ranges) == 0 {
+		context.addResult(prefix + trailing)
+		return
 	}
 
+	r := ranges[0]
+	for x := r.low; ; x += r.step {
+		expandNumericRanges(context, prefix+r.prefix+fmt.Sprintf(r.format, x), ranges[1:], trailing)
+
+		// Checked before stepping, since x + step may overflow.
+		if x > r.high-r.step {
+			break
+		}
+	}
+}
+
+func parseDecimalRange(val string, match []string) (numericRange, string, error) {
 	leftStr := match[1]
 	leftStrToMatch := match[1]
 	leftN := match[2]
 	rightStr := match[3]
 	rightN := match[4]
-	trailing := match[5]
+	trailing := match[6]
+
+	// a1..a4 is valid, a1..b4 is invalid
+	if len(rightStr) != 0 && leftStrToMatch != rightStr {
+		return numericRange{}, "", errors.New(fmt.Sprintf("Mismatched prefixes in range: %s", val))
+	}
+
+	step, err := rangeStep(val, match[5])
+	if err != nil {
+		return numericRange{}, "", err
+	}
+
+	low, err := parseRangeNumber(val, leftN, 10)
+	if err != nil {
+		return numericRange{}, "", err
+	}
+	high, err := parseRangeNumber(val, rightN, 10)
+	if err != nil {
+		return numericRange{}, "", err
+	}
+
+	// Descending ranges expand the same as their ascending equivalent.
+	if low > high {
+		low, high = high, low
+		leftN, rightN = rightN, leftN
+	}
 
 	for {
 		if len(leftN) <= len(rightN) {
@@ -363,37 +911,101 @@ func (n nodeText) visit(state *State, context *evalContext) error {
 		leftN = leftN[1:]
 	}
 
-	// a1..a4 is valid, a1..b4 is invalid
-	if len(rightStr) != 0 && leftStrToMatch != rightStr {
-		context.addResult(n.val)
+	format := "%0" + strconv.Itoa(len(leftN)) + "d"
+	return numericRange{leftStr, format, low, high, step}, trailing, nil
+}
+
+// Hex ranges keep the 0x marker and letter case of their left hand side, and
+// are padded to its width. Unlike decimal ranges, leading digits are never
+// moved into the prefix.
+func parseHexRange(val string, match []string) (numericRange, string, error) {
+	leftStr := match[1]
+	marker := match[2]
+	leftN := match[3]
+	rightStr := match[4]
+	rightN := match[5]
+	trailing := match[7]
+
+	if len(rightStr) != 0 && leftStr != rightStr {
+		return numericRange{}, "", errors.New(fmt.Sprintf("Mismatched prefixes in range: %s", val))
+	}
+
+	step, err := rangeStep(val, match[6])
+	if err != nil {
+		return numericRange{}, "", err
+	}
+
+	low, err := parseRangeNumber(val, leftN, 16)
+	if err != nil {
+		return numericRange{}, "", err
+	}
+	high, err := parseRangeNumber(val, rightN, 16)
+	if err != nil {
+		return numericRange{}, "", err
 	}
 
-	width := strconv.Itoa(len(leftN))
-	low, _ := strconv.Atoi(leftN)
-	high, _ := strconv.Atoi(rightN)
+	if low > high {
+		low, high = high, low
+		leftN = rightN
+	}
 
-	for x := low; x <= high; x++ {
-		context.addResult(fmt.Sprintf("%s%0"+width+"d%s", leftStr, x, trailing))
+	verb := "x"
+	if strings.ToLower(leftN) != leftN {
+		verb = "X"
 	}
 
-	return nil
+	format := "%0" + strconv.Itoa(len(leftN)) + verb
+	return numericRange{leftStr + marker, format, low, high, step}, trailing, nil
+}
+
+func rangeStep(val string, step string) (int64, error) {
+	if step == "" {
+		return 1, nil
+	}
+
+	n, err := parseRangeNumber(val, step[1:], 10)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New(fmt.Sprintf("Range step must be positive: %s", val))
+	}
+	return n, nil
+}
+
+// parseRangeNumber parses a bound or step of a range, which must fit in an
+// int64.
+func parseRangeNumber(val string, n string, base int) (int64, error) {
+	x, err := strconv.ParseInt(n, base, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Number out of range in range: %s", val))
+	}
+	return x, nil
 }
 
 func (n nodeGroupQuery) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
 	subContext := context.sub()
 	// TODO: Handle errors
 	n.node.(evalNode).visit(state, &subContext)
 	lookingFor := subContext.currentResult
 
-	for groupName, group := range state.clusters[state.defaultCluster] {
+	groups, err := state.cluster(state.fold(state.defaultCluster))
+	if err != nil {
+		return err
+	}
+
+	for groupName, group := range groups {
 		groupContext := context.sub()
 		for _, value := range group {
 			// TODO: Handle errors
 			evalRangeInplace(value, state, &groupContext)
 		}
 
+		inGroup := context.contains(groupContext.currentResult)
 		for x := range lookingFor.Iter() {
-			if groupContext.currentResult.Contains(x) {
+			if inGroup(x.(string)) {
 				context.addResult(groupName)
 				break
 			}
@@ -402,13 +1014,31 @@ func (n nodeGroupQuery) visit(state *State, context *evalContext) error {
 	return nil
 }
 
+// Functions returns the names of all functions that can be used in queries,
+// in alphabetical order.
+func Functions() []string {
+	return []string{"allclusters", "clusters", "count", "deps", "domain",
+		"extract", "has", "hasall", "hasnot", "lacks", "lower", "not", "prefix",
+		"refs", "shortname", "sub", "suffix"}
+}
+
 func (n nodeFunction) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
+	if context.foldCase {
+		n.name = strings.ToLower(n.name)
+	}
+
 	switch n.name {
 	case "allclusters":
 		if err := n.verifyParams(0); err != nil {
 			return err
 		}
-		for clusterKey, _ := range state.clusters {
+		clusters, err := state.allClusters()
+		if err != nil {
+			return err
+		}
+		for clusterKey, _ := range clusters {
 			context.addResult(clusterKey)
 		}
 	case "count":
@@ -419,26 +1049,58 @@ func (n nodeFunction) visit(state *State, context *evalContext) error {
 		n.params[0].(evalNode).visit(state, &valueContext)
 
 		context.addResult(strconv.Itoa(valueContext.currentResult.Cardinality()))
-	case "has":
+	case "has", "hasall", "hasnot":
 		if err := n.verifyParams(2); err != nil {
 			return err
 		}
 
 		keyContext := context.sub()
-		valueContext := context.sub()
-		n.params[0].(evalNode).visit(state, &keyContext)
-		n.params[1].(evalNode).visit(state, &valueContext)
+		if err := n.params[0].(evalNode).visit(state, &keyContext); err != nil {
+			return err
+		}
 
-		key := (<-keyContext.resultIter()).(string)
+		matches, err := n.valueMatcher(state, context, 1)
+		if err != nil {
+			return err
+		}
 
-		for clusterName, _ := range state.clusters {
-			subContext := context.subCluster(clusterName)
-			clusterLookup(state, &subContext, key)
+		clusters, err := state.allClusters()
+		if err != nil {
+			return err
+		}
 
-			l := subContext.currentResult.Set
-			r := valueContext.currentResult.Set
+		for clusterName, _ := range clusters {
+			found := clusterHas(state, context, clusterName, keyContext.currentResult,
+				matches, n.name == "hasall")
 
-			if l.Intersect(r).Cardinality() > 0 {
+			if found != (n.name == "hasnot") {
+				context.addResult(clusterName)
+			}
+		}
+	case "lacks":
+		if err := n.verifyParams(1); err != nil {
+			return err
+		}
+
+		keyContext := context.sub()
+		if err := n.params[0].(evalNode).visit(state, &keyContext); err != nil {
+			return err
+		}
+
+		clusters, err := state.allClusters()
+		if err != nil {
+			return err
+		}
+
+		for clusterName, cluster := range clusters {
+			found := false
+			for key := range keyContext.resultIter() {
+				if _, ok := cluster[state.fold(key.(string))]; ok {
+					found = true
+				}
+			}
+
+			if !found {
 				context.addResult(clusterName)
 			}
 		}
@@ -449,24 +1111,242 @@ func (n nodeFunction) visit(state *State, context *evalContext) error {
 		subContext := context.sub()
 		n.params[0].(evalNode).visit(state, &subContext)
 
-		lookingFor := subContext.currentResult
+		lookingFor := context.contains(subContext.currentResult)
+
+		clusters, err := state.allClusters()
+		if err != nil {
+			return err
+		}
 
-		for clusterName, _ := range state.clusters {
+		for clusterName, _ := range clusters {
 			subContext = context.subCluster(clusterName)
 			clusterLookup(state, &subContext, "CLUSTER")
 
 			for value := range subContext.resultIter() {
-				if lookingFor.Contains(value) {
+				if lookingFor(value.(string)) {
 					context.addResult(clusterName)
 				}
 			}
 		}
+	case "not":
+		if err := n.verifyParams(1); err != nil {
+			return err
+		}
+		return nodeComplement{n.params[0]}.visit(state, context)
+	case "sub":
+		if err := n.verifyParams(3); err != nil {
+			return err
+		}
+		r, err := n.regexpParam(context, 1)
+		if err != nil {
+			return err
+		}
+		repl, err := n.singleParam(state, context, 2)
+		if err != nil {
+			return err
+		}
+		return n.mapParam(state, context, func(x string) string {
+			context.charge(costMatch, 1)
+			return r.ReplaceAllString(x, repl)
+		})
+	case "extract":
+		if len(n.params) != 3 {
+			if err := n.verifyParams(2); err != nil {
+				return err
+			}
+		}
+		r, err := n.regexpParam(context, 1)
+		if err != nil {
+			return err
+		}
+
+		group := 0
+		if r.NumSubexp() > 0 {
+			group = 1
+		}
+		if len(n.params) == 3 {
+			name, err := n.singleParam(state, context, 2)
+			if err != nil {
+				return err
+			}
+			group = r.SubexpIndex(name)
+			if group < 0 {
+				return errors.New(fmt.Sprintf("No group named %s in /%s/", name, r))
+			}
+		}
+
+		return n.mapParam(state, context, func(x string) string {
+			context.charge(costMatch, 1)
+			match := r.FindStringSubmatch(x)
+			if match == nil {
+				return ""
+			}
+			return match[group]
+		})
+	case "prefix", "suffix":
+		if err := n.verifyParams(2); err != nil {
+			return err
+		}
+		affixContext := context.sub()
+		if err := n.params[1].(evalNode).visit(state, &affixContext); err != nil {
+			return err
+		}
+		for affix := range affixContext.resultIter() {
+			a := affix.(string)
+			err := n.mapParam(state, context, func(x string) string {
+				if n.name == "prefix" {
+					return a + x
+				}
+				return x + a
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case "shortname":
+		if err := n.verifyParams(1); err != nil {
+			return err
+		}
+		return n.mapParam(state, context, func(x string) string {
+			return strings.SplitN(x, ".", 2)[0]
+		})
+	case "domain":
+		if err := n.verifyParams(1); err != nil {
+			return err
+		}
+		return n.mapParam(state, context, func(x string) string {
+			tokens := strings.SplitN(x, ".", 2)
+			if len(tokens) < 2 {
+				return ""
+			}
+			return tokens[1]
+		})
+	case "lower":
+		if err := n.verifyParams(1); err != nil {
+			return err
+		}
+		return n.mapParam(state, context, strings.ToLower)
+	case "refs", "deps":
+		if len(n.params) != 2 {
+			if err := n.verifyParams(1); err != nil {
+				return err
+			}
+		}
+		return n.referencingClusters(state, context)
 	default:
 		return errors.New(fmt.Sprintf("Unknown function: %s", n.name))
 	}
 	return nil
 }
 
+// valueMatcher returns a function that reports whether a result contains the
+// value given by the parameter at index i. A regex parameter matches if any
+// value in the result matches it, otherwise the parameter is evaluated and
+// matches if it shares any value with the result.
+func (n nodeFunction) valueMatcher(state *State, context *evalContext, i int) (func(Result) bool, error) {
+	switch n.params[i].(type) {
+	case nodeRegexp:
+		r, err := n.regexpParam(context, i)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(values Result) bool {
+			context.charge(costMatch, values.Cardinality())
+			found := false
+			for x := range values.Iter() {
+				if r.MatchString(x.(string)) {
+					found = true
+				}
+			}
+			return found
+		}, nil
+	default:
+		valueContext := context.sub()
+		if err := n.params[i].(evalNode).visit(state, &valueContext); err != nil {
+			return nil, err
+		}
+
+		wanted := context.contains(valueContext.currentResult)
+		return func(values Result) bool {
+			for x := range values.Iter() {
+				if wanted(x.(string)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+}
+
+// clusterHas reports whether the values at any of the given keys in a cluster
+// satisfy matches. If all is true, every key must satisfy it instead. A
+// cluster never matches an empty set of keys.
+func clusterHas(state *State, context *evalContext, clusterName string, keys Result, matches func(Result) bool, all bool) bool {
+	matched := 0
+	for key := range keys.Iter() {
+		subContext := context.subCluster(clusterName)
+		// Errors in unrelated clusters should not prevent others from matching.
+		clusterLookup(state, &subContext, key.(string))
+
+		if matches(subContext.currentResult) {
+			matched++
+		}
+	}
+
+	if all {
+		return matched > 0 && matched == keys.Cardinality()
+	}
+	return matched > 0
+}
+
+// mapParam evaluates the first parameter and adds f applied to each of its
+// values to the context. Empty values produced by f are dropped.
+func (n nodeFunction) mapParam(state *State, context *evalContext, f func(string) string) error {
+	valueContext := context.sub()
+	if err := n.params[0].(evalNode).visit(state, &valueContext); err != nil {
+		return err
+	}
+
+	for x := range valueContext.resultIter() {
+		if value := f(x.(string)); value != "" {
+			context.addResult(value)
+		}
+	}
+	return nil
+}
+
+// singleParam evaluates the parameter at index i, which must return exactly
+// one value.
+func (n nodeFunction) singleParam(state *State, context *evalContext, i int) (string, error) {
+	paramContext := context.sub()
+	if err := n.params[i].(evalNode).visit(state, &paramContext); err != nil {
+		return "", err
+	}
+
+	if paramContext.currentResult.Cardinality() != 1 {
+		return "", errors.New(fmt.Sprintf(
+			"Param %d of %s must be a single value, got %d.",
+			i+1,
+			n.name,
+			paramContext.currentResult.Cardinality(),
+		))
+	}
+	return (<-paramContext.resultIter()).(string), nil
+}
+
+// regexpParam compiles the parameter at index i, which must be a regex
+// literal such as /foo/.
+func (n nodeFunction) regexpParam(context *evalContext, i int) (*regexp.Regexp, error) {
+	switch n.params[i].(type) {
+	case nodeRegexp:
+		return context.compileRegexp(n.params[i].(nodeRegexp).val)
+	default:
+		return nil, errors.New(fmt.Sprintf(
+			"Param %d of %s must be a regex, got: %s", i+1, n.name, n.params[i]))
+	}
+}
+
 func (n nodeFunction) verifyParams(expected int) error {
 	if len(n.params) != expected {
 		msg := fmt.Sprintf("Wrong number of params for %s: expected %d, got %d.",
@@ -480,18 +1360,21 @@ func (n nodeFunction) verifyParams(expected int) error {
 }
 
 func (n nodeRegexp) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
+
 	if context.workingResult == nil {
 		subContext := context.sub()
 		state.allValues(&subContext)
 		context.workingResult = &subContext.currentResult
 	}
 
-	r, err := regexp.Compile(n.val)
+	r, err := context.compileRegexp(n.val)
 
 	if err != nil {
 		return err
 	}
 
+	context.charge(costMatch, context.workingResult.Cardinality())
 	for x := range context.workingResult.Iter() {
 		if r.MatchString(x.(string)) {
 			context.addResult(x.(string))
@@ -502,6 +1385,7 @@ func (n nodeRegexp) visit(state *State, context *evalContext) error {
 }
 
 func (n nodeNull) visit(state *State, context *evalContext) error {
+	context.charge(costNode, 1)
 	return nil
 }
 
@@ -510,41 +1394,89 @@ func (state *State) allValues(context *evalContext) error {
 	return evalRangeInplace("@{%"+state.defaultCluster+":KEYS}", state, context)
 }
 
+// universe adds the values that complements are taken relative to, as
+// configured by SetUniverseKey.
+func (state *State) universe(context *evalContext) error {
+	if state.universeKey == "" {
+		return state.allValues(context)
+	}
+
+	subContext := context.subCluster(state.defaultCluster)
+	if err := clusterLookup(state, &subContext, state.universeKey); err != nil {
+		return err
+	}
+	for x := range subContext.resultIter() {
+		context.addResult(x.(string))
+	}
+	return nil
+}
+
 func clusterLookup(state *State, context *evalContext, key string) error {
+	context.charge(costLookup, 1)
+
 	var evalErr error
 	clusterName := context.currentClusterName
 	if clusterName == "" {
 		clusterName = state.defaultCluster
 	}
-	cluster := state.clusters[clusterName]
+	clusterName = state.fold(clusterName)
+	cluster, err := state.cluster(clusterName)
+	if err != nil {
+		return err
+	}
 
-	if key == "KEYS" {
+	if key == "KEYS" || state.caseInsensitive && strings.EqualFold(key, "KEYS") {
 		for k, _ := range cluster {
-			context.currentResult.Add(k) // TODO: addResult
+			context.addResult(k)
 		}
 		return nil
 	}
 
-	if state.clusterCache[clusterName] == nil {
-		state.clusterCache[clusterName] = map[string]*Result{}
+	key = state.fold(key)
+	clusterExp, ok := cluster[key]
+	if !ok {
+		// Nothing to cache, so that looking up keys that clusters do not have,
+		// as has() does, is safe on a primed state.
+		return nil
 	}
 
-	if state.clusterCache[clusterName][key] == nil {
-		clusterExp := cluster[key] // TODO: Error handling
+	if state.clusterCache[clusterName] == nil {
+		state.clusterCache[clusterName] = map[string]*cacheEntry{}
+	}
 
+	entry := state.clusterCache[clusterName][key]
+	if state.observer != nil {
+		if entry == nil {
+			state.observer.CacheMiss(clusterName, key)
+		} else {
+			state.observer.CacheHit(clusterName, key)
+		}
+	}
+	if entry == nil {
 		subContext := context.subCluster(context.currentClusterName)
 
-		for _, value := range clusterExp {
-			evalErr = evalRangeInplace(value, state, &subContext)
-			if evalErr != nil {
-				return evalErr
+		deps := newDependencies(clusterName)
+		evalErr = state.recordInto(deps, func() error {
+			for _, value := range clusterExp {
+				if err := evalRangeInplace(value, state, &subContext); err != nil {
+					return err
+				}
 			}
+			return nil
+		})
+		if evalErr == nil {
+			evalErr = subContext.costErr()
+		}
+		if evalErr != nil {
+			return evalErr
 		}
 
-		state.clusterCache[clusterName][key] = &subContext.currentResult
+		entry = &cacheEntry{&subContext.currentResult, deps}
+		state.clusterCache[clusterName][key] = entry
 	}
+	state.recordDependencies(entry.deps)
 
-	for x := range state.clusterCache[clusterName][key].Iter() {
+	for x := range entry.result.Iter() {
 		context.addResult(x.(string))
 	}
 	return nil
@@ -560,9 +1492,42 @@ func (c *evalContext) addResult(value string) {
 			fmt.Sprintf("Value would exceed max query size: %s...", value[0:20])))
 	}
 
+	if c.foldCase {
+		if c.folded == nil {
+			c.folded = map[string]bool{}
+			for x := range c.currentResult.Iter() {
+				c.folded[strings.ToLower(x.(string))] = true
+			}
+		}
+		lower := strings.ToLower(value)
+		if c.folded[lower] {
+			return
+		}
+		c.folded[lower] = true
+	}
 	c.currentResult.Add(value)
 }
 
+// contains returns a function reporting whether a value is in result, ignoring
+// case if the context does. Values are lowercased as they are evaluated, but
+// constants such as q() are not, so they still need to be compared ignoring
+// case.
+func (c *evalContext) contains(result Result) func(string) bool {
+	if !c.foldCase {
+		return func(value string) bool {
+			return result.Contains(value)
+		}
+	}
+
+	folded := map[string]bool{}
+	for x := range result.Iter() {
+		folded[strings.ToLower(x.(string))] = true
+	}
+	return func(value string) bool {
+		return folded[strings.ToLower(value)]
+	}
+}
+
 func (c *evalContext) resultIter() <-chan interface{} {
 	return c.currentResult.Iter()
 }
@@ -79,6 +79,67 @@ func TestHasIntersect(t *testing.T) {
 	}))
 }
 
+func TestHasMultipleKeys(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a": Cluster{"TYPE": []string{"one"}, "ROLE": []string{"two"}},
+		"b": Cluster{"TYPE": []string{"two"}, "ROLE": []string{"one"}},
+		"c": Cluster{"TYPE": []string{"one"}, "ROLE": []string{"one"}},
+		"d": Cluster{"TYPE": []string{"three"}},
+	})
+
+	testEval(t, NewResult("a", "b", "c"), "has({TYPE,ROLE};one)", state)
+	testEval(t, NewResult("c"), "hasall({TYPE,ROLE};one)", state)
+	testEval(t, NewResult(), "has(%missing;one)", state)
+	testEval(t, NewResult(), "hasall(%missing;one)", state)
+}
+
+func TestHasRegexp(t *testing.T) {
+	testEval(t, NewResult("a", "b"), "has(TYPE;/redis/)", multiCluster(map[string]Cluster{
+		"a": Cluster{"TYPE": []string{"redis"}},
+		"b": Cluster{"TYPE": []string{"mysql", "redis-slave"}},
+		"c": Cluster{"TYPE": []string{"mysql"}},
+	}))
+}
+
+func TestHasNot(t *testing.T) {
+	testEval(t, NewResult("c", "d"), "hasnot(TYPE;one)", multiCluster(map[string]Cluster{
+		"a": Cluster{"TYPE": []string{"one", "two"}},
+		"b": Cluster{"TYPE": []string{"two", "one"}},
+		"c": Cluster{"TYPE": []string{"three"}},
+		"d": Cluster{},
+	}))
+}
+
+func TestLacks(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a": Cluster{"TYPE": []string{"one"}},
+		"b": Cluster{"DOWN": []string{}},
+		"c": Cluster{},
+	})
+
+	testEval(t, NewResult("b", "c"), "lacks(TYPE)", state)
+	testEval(t, NewResult("c"), "lacks({TYPE,DOWN})", state)
+}
+
+func TestRefsDeps(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"x"}, "DOWN": []string{"y"}},
+		"b":      Cluster{"CLUSTER": []string{"%a - %a:DOWN", "$ALL"}, "ALL": []string{"%c"}},
+		"c":      Cluster{"CLUSTER": []string{"has(TYPE;redis)", "%{a,d}:KEYS"}},
+		"GROUPS": Cluster{"web": []string{"@db"}, "db": []string{"%c"}},
+	})
+
+	testEval(t, NewResult("b", "c"), "refs(a)", state)
+	testEval(t, NewResult("b", "c"), "refs(a;DOWN)", state)
+	testEval(t, NewResult("c"), "refs(a;TYPE)", state)
+	testEval(t, NewResult("GROUPS", "b"), "refs(c)", state)
+	testEval(t, NewResult("a", "c"), "deps(b)", state)
+	testEval(t, NewResult("c"), "deps(b;ALL)", state)
+	testEval(t, NewResult("a", "d"), "deps(c)", state)
+	testEval(t, NewResult("c"), "deps(GROUPS)", state)
+	testError(t, "Wrong number of params for refs: expected 1, got 3.", "refs(a;b;c)")
+}
+
 func TestIntersectEasy(t *testing.T) {
 	testEval(t, NewResult("a"), "a & a", emptyState())
 	testEval(t, NewResult(), "a & b", emptyState())
@@ -219,6 +280,184 @@ func TestGroupLookupAndSubtractiong(t *testing.T) {
 	testEval(t, NewResult("a"), "{a} - b", emptyState())
 }
 
+func TestComplement(t *testing.T) {
+	state := multiGroup(Cluster{
+		"dc1":  []string{"a", "b"},
+		"dc2":  []string{"c"},
+		"down": []string{"b", "c"},
+	})
+
+	testEval(t, NewResult("a"), "!@down", state)
+	testEval(t, NewResult("a"), "not(@down)", state)
+	testEval(t, NewResult("a", "d"), "!@down,d", state)
+	testEval(t, NewResult("b"), "@dc1 & !a", state)
+	testEval(t, NewResult("a", "c"), "!/b/", state)
+}
+
+func TestComplementOfFunction(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a":      Cluster{"TYPE": []string{"redis"}},
+		"b":      Cluster{"TYPE": []string{"mysql"}},
+		"GROUPS": Cluster{"all": []string{"a", "b", "c"}, "down": []string{"c"}},
+	})
+
+	testEval(t, NewResult("b", "c"), "not(has(TYPE;redis))", state)
+	testEval(t, NewResult("c"), "not(allclusters())", state)
+	testEval(t, NewResult("c"), "not(not(@down))", state)
+	testEval(t, NewResult("b", "c"), "!has(TYPE;redis)", state)
+}
+
+func TestComplementUniverseKey(t *testing.T) {
+	state := multiGroup(Cluster{
+		"ALL":  []string{"a", "b"},
+		"dc2":  []string{"c"},
+		"down": []string{"b"},
+	})
+	state.SetUniverseKey("ALL")
+
+	testEval(t, NewResult("a"), "!@down", state)
+}
+
+func TestCaseSensitive(t *testing.T) {
+	state := singleCluster("DC1", Cluster{"CLUSTER": []string{"WEB1"}})
+
+	testEval(t, NewResult(), "WEB1 & web1", state)
+	testEval(t, NewResult(), "%dc1", state)
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	state := emptyState()
+	state.AddCluster("DC1", Cluster{
+		"CLUSTER": []string{"WEB1", "$Down"},
+		"DOWN":    []string{"Web2"},
+		"Type":    []string{"Redis"},
+	})
+	state.AddCluster("groups", Cluster{"Hosts": []string{"web1"}})
+	state.SetCaseInsensitive(true)
+
+	testEval(t, NewResult("web1"), "WEB1 & web1", state)
+	testEval(t, NewResult("web1", "web2"), "%dc1", state)
+	testEval(t, NewResult("web1", "web2"), "%DC1:cluster", state)
+	testEval(t, NewResult("cluster", "down", "type"), "%dc1:KEYS", state)
+	testEval(t, NewResult("dc1"), "HAS(TYPE;redis)", state)
+	testEval(t, NewResult("dc1"), "has(type;/REDIS/)", state)
+	testEval(t, NewResult("dc1"), "clusters(Web2)", state)
+	testEval(t, NewResult("web1"), "@HOSTS", state)
+	testEval(t, NewResult("hosts"), "?WEB1", state)
+	testEval(t, NewResult("web1"), "%dc1 & /B1/", state)
+}
+
+// Clusters and keys whose names only differ in case are merged, the same way
+// however the state was built.
+func TestCaseInsensitiveMerge(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		state := multiCluster(map[string]Cluster{
+			"Web": Cluster{"CLUSTER": []string{"web1"}, "Type": []string{"redis"}},
+			"web": Cluster{"CLUSTER": []string{"web2"}, "TYPE": []string{"mysql"}},
+			"WEB": Cluster{"Cluster": []string{"web3"}},
+		})
+		state.SetCaseInsensitive(true)
+
+		testEval(t, NewResult("web1", "web2", "web3"), "%web", state)
+		testEval(t, NewResult("mysql", "redis"), "%WEB:type", state)
+		testEval(t, NewResult("web"), "allclusters()", state)
+
+		expected := Cluster{"cluster": []string{"web3", "web1", "web2"}, "type": []string{"redis", "mysql"}}
+		if !reflect.DeepEqual(state.Clusters()["web"], expected) {
+			t.Fatalf("Clusters()[web] = %v, expected %v", state.Clusters()["web"], expected)
+		}
+	}
+}
+
+func TestCaseInsensitiveConstants(t *testing.T) {
+	state := singleCluster("a", Cluster{
+		"CLUSTER": []string{"WEB1", "WEB2"},
+		"DOC":     []string{"q(http://Example.com/Path)"},
+	})
+	state.SetCaseInsensitive(true)
+
+	testEval(t, NewResult("http://Example.com/Path"), "%a:DOC", state)
+	testEval(t, NewResult("Web 1"), `"Web 1"`, state)
+	testEval(t, NewResult("WEB1"), `"WEB1" & %a`, state)
+	testEval(t, NewResult("web2"), `%a - "WEB1"`, state)
+	testEval(t, NewResult("web2", "WEB3"), `%a ^ ("WEB1" , "WEB3")`, state)
+	testEval(t, NewResult("a"), "has(DOC;q(HTTP://EXAMPLE.COM/PATH))", state)
+	testEval(t, NewResult("a"), `clusters("WEB2")`, state)
+	testEval(t, NewResult("web1", "web2"), `%a , "WEB1"`, state)
+	testEval(t, NewResult("WEB1", "web2"), `"WEB1" , %a`, state)
+	testEval(t, NewResult("Web1"), `"Web1" , "WEB1" , web1`, state)
+	testEval(t, NewResult("A1", "a2"), `q(A1) , {a,A}{1,2}`, state)
+
+	derivation, err := state.Why("%a:DOC", "http://example.com/path")
+	if err != nil || !derivation.Included {
+		t.Errorf("Expected constant to be explained ignoring case, got: %v %v", derivation, err)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	state := singleCluster("café", Cluster{"CLUSTER": []string{"hôte1", "q(hôte2)"}})
+
+	testError2(t, "Could not parse query: %café", "%café", state)
+
+	state.SetUnicodeIdentifiers(true)
+	testEval(t, NewResult("hôte1", "hôte2"), "%café", state)
+	testEval(t, NewResult("hôte1"), "%café & hôte1", state)
+	testEval(t, NewResult("ü1", "ü2"), "ü1..2", state)
+}
+
+func TestNumericRanges(t *testing.T) {
+	testEval(t, NewResult("a1", "a2"), "a1..a2", emptyState())
+	testEval(t, NewResult("a1", "a2"), "a1..2", emptyState())
+	testEval(t, NewResult("a08", "a09", "a10"), "a08..10", emptyState())
+	testEval(t, NewResult("a001", "a002"), "a001..2", emptyState())
+	testEval(t, NewResult("a1", "a3", "a5"), "a1..6/2", emptyState())
+	testEval(t, NewResult("a1.b", "a4.b"), "a1..4/3.b", emptyState())
+	testEval(t, NewResult("a2", "a3", "a4"), "a4..2", emptyState())
+	testEval(t, NewResult("a2", "a4"), "a4..2/2", emptyState())
+	testEval(t, NewResult("a8", "a9", "a10"), "{a10..8}", emptyState())
+	testEval(t, NewResult("n0x0e", "n0x0f", "n0x10"), "n0x0e..0x10", emptyState())
+	testEval(t, NewResult("n0x0e", "n0x0f", "n0x10"), "n0x0e..n0x10", emptyState())
+	testEval(t, NewResult("n0XE", "n0XF"), "n0XE..0xf", emptyState())
+	testEval(t, NewResult("n0x0a", "n0x0c"), "n0x0a..0x0c/2", emptyState())
+	testEval(t, NewResult("n0x0a.b"), "n0x0a..0x0a.b", emptyState())
+	testEval(t, NewResult("n0x1", "n0x2"), "n0x1..2", emptyState())
+}
+
+func TestMultipleNumericRanges(t *testing.T) {
+	testEval(t, NewResult("r1-h1", "r1-h2", "r2-h1", "r2-h2"), "r1..2-h1..2", emptyState())
+	testEval(t, NewResult("r1-h1", "r1-h2", "r2-h1", "r2-h2"), "r1..r2-h1..-h2", emptyState())
+	testEval(t, NewResult("r1-h09", "r1-h10", "r3-h09", "r3-h10"), "r1..3/2-h09..10", emptyState())
+	testEval(t, NewResult("r1-n0x0a", "r1-n0x0b", "r2-n0x0a", "r2-n0x0b"), "r1..2-n0x0a..0x0b", emptyState())
+	testEval(t, NewResult("a1.b1.c1", "a1.b1.c2", "a2.b1.c1", "a2.b1.c2"), "a1..2.b1.c1..2", emptyState())
+	testError(t, "Mismatched prefixes in range: r1..2-h1..g2", "r1..2-h1..g2")
+	testError(t, "Range step without a range: r1..2-h/2", "r1..2-h/2")
+}
+
+func TestNumericRangeErrors(t *testing.T) {
+	testError(t, "Mismatched prefixes in range: a1..b4", "a1..b4")
+	testError(t, "Mismatched prefixes in range: n0x1..m0x2", "n0x1..m0x2")
+	testError(t, "Range step must be positive: a1..4/0", "a1..4/0")
+	testError(t, "Range step without a range: a/2", "a/2")
+	testError(t, "Number out of range in range: a1..99999999999999999999", "a1..99999999999999999999")
+	testError(t, "Number out of range in range: n0x1..0x10000000000000000", "n0x1..0x10000000000000000")
+	testError(t, "Number out of range in range: a1..5/99999999999999999999", "a1..5/99999999999999999999")
+}
+
+func TestNumericRangeOverflow(t *testing.T) {
+	testEval(t, NewResult("a1"), "a1..5/9223372036854775807", emptyState())
+	testEval(t, NewResult("a9223372036854775806", "a9223372036854775807"),
+		"a9223372036854775806..9223372036854775807", emptyState())
+}
+
+func TestFunctions(t *testing.T) {
+	for _, name := range Functions() {
+		_, err := emptyState().Query(name + "()")
+		if err != nil && strings.HasPrefix(err.Error(), "Unknown function") {
+			t.Errorf("Functions() includes %s, but it is unknown", name)
+		}
+	}
+}
+
 func TestInvalidLex(t *testing.T) {
 	testError(t, "No closing / for match", "/")
 }
@@ -266,6 +505,19 @@ func TestQ(t *testing.T) {
 	testEval(t, NewResult("http://foo/bar?yeah"), "q(http://foo/bar?yeah)", emptyState())
 }
 
+func TestQuoted(t *testing.T) {
+	testEval(t, NewResult("a b", ","), `"a b","," `, emptyState())
+	testEval(t, NewResult(`a"b`), `"a\"b"`, emptyState())
+	testEval(t, NewResult(`a\`), `"a\\"`, emptyState())
+	testEval(t, NewResult("a\tb\n"), `"a\tb\n"`, emptyState())
+	testEval(t, NewResult("é", "é", "\xff"), `"\u00e9","\303\251","\xff"`, emptyState())
+	testEval(t, NewResult(`a\"b`), `'a\"b'`, emptyState())
+	testEval(t, NewResult("ü"), `"ü"`, emptyState())
+
+	testError2(t, `Could not parse query: "\q"`, `"\q"`, emptyState())
+	testError2(t, `Could not parse query: "\uD800"`, `"\uD800"`, emptyState())
+}
+
 func TestQueryGroups(t *testing.T) {
 	testEval(t, NewResult("one", "two"), "?a", multiGroup(Cluster{
 		"one":   []string{"a"},
@@ -285,6 +537,72 @@ func TestAllClusters(t *testing.T) {
 	testEval(t, NewResult("a"), "allclusters()", singleCluster("a", Cluster{}))
 }
 
+func TestSub(t *testing.T) {
+	testEval(t, NewResult("web1-ilo.dc1", "web2-ilo.dc1"), "sub(web1..2.dc1;/^([^.]+)/;q(${1}-ilo))", emptyState())
+	testEval(t, NewResult("web1"), "sub(web1.dc1;/\\..*$/;q())", emptyState())
+	testEval(t, NewResult("a"), "sub(ab,b;/b/;q())", emptyState())
+}
+
+func TestExtract(t *testing.T) {
+	testEval(t, NewResult("12", "3"), "extract(r12-web1.dc1,r3-web2.dc1,web3.dc1;/^r(\\d+)-/)", emptyState())
+	testEval(t, NewResult("r12", "r3"), "extract(r12-web1.dc1,r3-web2.dc1;/^r\\d+/)", emptyState())
+	testEval(t, NewResult("web1", "web2"), "extract(r12-web1.dc1,r3-web2.dc1;/^r(?P<rack>\\d+)-(?P<host>[^.]+)/;host)", emptyState())
+}
+
+func TestExtractErrors(t *testing.T) {
+	testError2(t, "No group named foo in /(?P<bar>a)/", "extract(a;/(?P<bar>a)/;foo)", emptyState())
+	testError2(t, "Wrong number of params for extract: expected 2, got 1.", "extract(a)", emptyState())
+}
+
+func TestRegexpCache(t *testing.T) {
+	a, _ := compileRegexp("^a+$")
+	b, _ := compileRegexp("^a+$")
+	if a != b {
+		t.Errorf("Expected compiled regex to be reused")
+	}
+}
+
+func TestPrefixSuffix(t *testing.T) {
+	testEval(t, NewResult("xa", "xb"), "prefix(a,b;x)", emptyState())
+	testEval(t, NewResult("xa", "ya"), "prefix(a;{x,y})", emptyState())
+	testEval(t, NewResult("a.dc1", "b.dc1"), "suffix(%a;.dc1)", singleCluster("a", Cluster{
+		"CLUSTER": []string{"a", "b"},
+	}))
+}
+
+func TestShortnameDomain(t *testing.T) {
+	testEval(t, NewResult("web1", "web2"), "shortname(web1.dc1,web2.dc2.example.com)", emptyState())
+	testEval(t, NewResult("dc1", "dc2.example.com"), "domain(web1.dc1,web2.dc2.example.com,web3)", emptyState())
+}
+
+func TestLower(t *testing.T) {
+	testEval(t, NewResult("web1.dc1"), "lower(%a)", singleCluster("a", Cluster{
+		"CLUSTER": []string{"q(WEB1.Dc1)"},
+	}))
+}
+
+func TestNestedFunctions(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a": Cluster{"CLUSTER": []string{"q(WEB1.dc1)", "q(Web2.dc2)"}, "TYPE": []string{"redis"}},
+		"b": Cluster{"TYPE": []string{"mysql"}},
+	})
+
+	testEval(t, NewResult("web1", "web2"), "lower(shortname(%a))", state)
+	testEval(t, NewResult("WEB1x", "Web2x"), "suffix(shortname(%a);x)", state)
+	testEval(t, NewResult("1"), "count(has(TYPE;redis))", state)
+	testEval(t, NewResult("2"), "count(allclusters())", state)
+	testEval(t, NewResult("xdc1", "xdc2"), "prefix(domain(%{has(TYPE;redis)});x)", state)
+	testError2(t, "Wrong number of params for lower: expected 1, got 2.", "lower(shortname(%a);x)", state)
+}
+
+func TestStringFunctionMaxText(t *testing.T) {
+	longString := strings.Repeat("a", MaxQuerySize)
+	testError2(t, "Value would exceed max query size: aaaaaaaaaaaaaaaaaaaa...", "suffix(%a;b)",
+		singleCluster("a", Cluster{
+			"CLUSTER": []string{longString},
+		}))
+}
+
 func TestLengthError(t *testing.T) {
 	longString := strings.Repeat("a", MaxQuerySize)
 	testEval(t, NewResult(longString), longString, emptyState())
@@ -296,10 +614,19 @@ func TestFunctionError(t *testing.T) {
 	testError2(t, "Wrong number of params for has: expected 2, got 1.", "has(x)", emptyState())
 	testError2(t, "Wrong number of params for has: expected 2, got 3.", "has(x;y;z)", emptyState())
 
+	testError2(t, "Wrong number of params for hasnot: expected 2, got 1.", "hasnot(x)", emptyState())
+	testError2(t, "Wrong number of params for lacks: expected 1, got 2.", "lacks(x;y)", emptyState())
+
 	testError2(t, "Wrong number of params for count: expected 1, got 0.", "count()", emptyState())
 	testError2(t, "Wrong number of params for clusters: expected 1, got 0.", "clusters()", emptyState())
 	testError2(t, "Wrong number of params for allclusters: expected 0, got 1.", "allclusters(x)", emptyState())
 
+	testError2(t, "Wrong number of params for sub: expected 3, got 2.", "sub(x;/x/)", emptyState())
+	testError2(t, "Param 2 of sub must be a regex, got: x", "sub(x;x;y)", emptyState())
+	testError2(t, "Param 3 of sub must be a single value, got 2.", "sub(x;/x/;{y,z})", emptyState())
+	testError2(t, "Wrong number of params for prefix: expected 2, got 1.", "prefix(x)", emptyState())
+	testError2(t, "Wrong number of params for lower: expected 1, got 0.", "lower()", emptyState())
+
 	testError2(t, "Unknown function: foobar", "foobar(x)", emptyState())
 }
 
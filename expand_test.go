@@ -3,8 +3,6 @@ package grange
 import (
 	"bufio"
 	"fmt"
-	"gopkg.in/v1/yaml"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -37,31 +35,12 @@ func TestExpand(t *testing.T) {
 }
 
 func runExpandSpec(t *testing.T, spec RangeSpec) {
-	state := NewState()
-	// Load YAML files
-	yamls, err := filepath.Glob(path.Dir(spec.path) + "/*.yaml")
+	state, err := LoadDir(path.Dir(spec.path))
 	if err != nil {
-		fmt.Println(err)
+		t.Errorf("%s", err)
 		return
 	}
 
-	for _, yamlPath := range yamls {
-		dat, err := ioutil.ReadFile(yamlPath)
-		if err != nil {
-			t.Errorf("Could not read: %s", yamlPath)
-		}
-		basename := path.Base(yamlPath)
-		name := strings.TrimSuffix(basename, ".yaml")
-
-		m := make(map[string]interface{})
-		err = yaml.Unmarshal(dat, &m)
-		if err != nil {
-			t.Errorf("Invalid YAML: %s", yamlPath)
-		}
-		c := yamlToCluster(name, m)
-		state.AddCluster(name, c)
-	}
-
 	actual, err := state.Query(spec.expr)
 
 	if err != nil {
@@ -70,6 +49,19 @@ func runExpandSpec(t *testing.T, spec RangeSpec) {
 		t.Errorf("failed %s:%d\n got: %s\nwant: %s",
 			spec.path, spec.line, actual, spec.results)
 	}
+
+	// The string form of the parsed query must expand the same way.
+	node, err := parseRange(spec.expr, false)
+	if err != nil {
+		return
+	}
+	actual, err = state.Query(node.String())
+	if err != nil {
+		t.Errorf("failed %s:%d\n%s: %s", spec.path, spec.line, node, err)
+	} else if !reflect.DeepEqual(actual, spec.results) {
+		t.Errorf("failed %s:%d\n%s\n got: %s\nwant: %s",
+			spec.path, spec.line, node, actual, spec.results)
+	}
 }
 
 func loadExpandSpec(t *testing.T, specpath string) {
@@ -98,41 +90,3 @@ func loadExpandSpec(t *testing.T, specpath string) {
 		runExpandSpec(t, currentSpec)
 	}
 }
-
-// Converts a generic YAML map to a cluster by extracting all the correctly
-// typed strings and discarding invalid values.
-func yamlToCluster(clusterName string, yaml map[string]interface{}) Cluster {
-	c := Cluster{}
-
-	for key, value := range yaml {
-		switch value.(type) {
-		case nil:
-			c[key] = []string{}
-		case string:
-			c[key] = []string{value.(string)}
-		case int:
-			c[key] = []string{fmt.Sprintf("%d", value.(int))}
-		case bool:
-			c[key] = []string{fmt.Sprintf("%s", value.(bool))}
-		case []interface{}:
-			result := []string{}
-
-			for _, x := range value.([]interface{}) {
-				switch x.(type) {
-				case string:
-					result = append(result, fmt.Sprintf("%s", x))
-				case int:
-					result = append(result, fmt.Sprintf("%d", x))
-				case bool:
-					result = append(result, fmt.Sprintf("%s", x))
-				default:
-					// discard
-				}
-			}
-			c[key] = result
-		default:
-			// discard
-		}
-	}
-	return c
-}
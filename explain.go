@@ -0,0 +1,93 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Explain parses a query and describes how it will be evaluated: first the
+// query with all implicit precedence made explicit, then the parse tree with
+// one node per line. It is intended for humans debugging a query, the format
+// may change between versions.
+func (state *State) Explain(input string) (string, error) {
+	if len(input) > MaxQuerySize {
+		return "", errors.New(fmt.Sprintf("Query is too long, max length is %d", MaxQuerySize))
+	}
+
+	node, err := parseRange(input, state.unicodeIdentifiers)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{node.String()}
+	state.explainNode(node, "", "", &lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func (state *State) explainNode(node parserNode, indent string, label string, lines *[]string) {
+	line := func(format string, args ...interface{}) {
+		*lines = append(*lines, indent+label+fmt.Sprintf(format, args...))
+	}
+	child := func(n parserNode, label string) {
+		state.explainNode(n, indent+"  ", label, lines)
+	}
+
+	switch n := node.(type) {
+	case nodeNull:
+		line("empty")
+	case nodeText:
+		if ranges, _, err := parseNumericRanges(n.val); err == nil && len(ranges) > 0 {
+			line("numeric range %s", n.val)
+		} else {
+			line("value %s", n.val)
+		}
+	case nodeConstant:
+		line("constant %s", n)
+	case nodeRegexp:
+		line("regex %s", n)
+	case nodeLocalClusterLookup:
+		line("key %s of the current cluster", n.key)
+	case nodeClusterLookup:
+		line("cluster lookup")
+		child(n.node, "cluster: ")
+		child(n.key, "key: ")
+	case nodeGroupQuery:
+		line("keys of %s containing", state.defaultCluster)
+		child(n.node, "")
+	case nodeComplement:
+		line("complement")
+		child(n.node, "")
+	case nodeOperator:
+		line("%s (%s)", n.op.describe(), n.op)
+		child(n.left, "")
+		child(n.right, "")
+	case nodeBraces:
+		line("brace expansion")
+		child(n.left, "left: ")
+		child(n.node, "inside: ")
+		child(n.right, "right: ")
+	case nodeFunction:
+		line("function %s", n.name)
+		for i, param := range n.params {
+			child(param, fmt.Sprintf("param %d: ", i+1))
+		}
+	default:
+		line("%s", n)
+	}
+}
+
+func (t operatorType) describe() string {
+	switch t {
+	case operatorIntersect:
+		return "intersection"
+	case operatorSubtract:
+		return "difference"
+	case operatorUnion:
+		return "union"
+	case operatorSymmetricDifference:
+		return "symmetric difference"
+	default:
+		panic("Unknown operatorType")
+	}
+}
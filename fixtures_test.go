@@ -0,0 +1,54 @@
+package grange
+
+// States shared between tests. Each call returns a new state, since tests
+// change them.
+
+// memoState has clusters with overlapping values, and a cluster that refers
+// to a key of another.
+func memoState() *State {
+	return multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"web1..3"}, "TYPE": []string{"redis"}, "X": []string{"x1"}},
+		"b":      Cluster{"CLUSTER": []string{"web3..4", "%a:X"}, "TYPE": []string{"mysql"}},
+		"GROUPS": Cluster{"web": []string{"web1..4"}, "db": []string{"db1"}},
+	})
+}
+
+// costState has a cluster that refers to another, so that looking it up
+// costs more until it is cached.
+func costState() *State {
+	return multiCluster(map[string]Cluster{
+		"a": Cluster{"CLUSTER": []string{"a1..3"}, "TYPE": []string{"redis"}},
+		"b": Cluster{"CLUSTER": []string{"%a", "b1"}, "TYPE": []string{"mysql"}},
+	})
+}
+
+// whyState has values that reach a result through several clusters and
+// operators.
+func whyState() *State {
+	return multiCluster(map[string]Cluster{
+		"dc1":    Cluster{"CLUSTER": []string{"web1..3", "$EXTRA"}, "EXTRA": []string{"db1"}, "TYPE": []string{"redis"}},
+		"down":   Cluster{"CLUSTER": []string{"web2", "%dc1:EXTRA"}},
+		"GROUPS": Cluster{"web": []string{"%dc1 & /web/"}},
+	})
+}
+
+// graphState has references of every kind between a few clusters.
+func graphState() *State {
+	return multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"x"}},
+		"b":      Cluster{"CLUSTER": []string{"%a - %a:DOWN", "%a,%c"}},
+		"c":      Cluster{"CLUSTER": []string{"has(TYPE;redis)", "$X"}, "X": []string{"*x"}},
+		"GROUPS": Cluster{"web": []string{"@db"}},
+	})
+}
+
+// referenceState has values that refer to clusters and keys in every way a
+// reference can be found.
+func referenceState() *State {
+	return multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"x"}, "DOWN": []string{"y"}},
+		"b":      Cluster{"CLUSTER": []string{"%a - %a:DOWN", "$ALL"}, "ALL": []string{"!%a", "/b/"}},
+		"c":      Cluster{"CLUSTER": []string{"has(TYPE;/redis/) & /c/", "%{%b}:{X,Y}", "%a,"}},
+		"GROUPS": Cluster{"web": []string{"@db", "?x"}, "db": []string{"*x"}},
+	})
+}
@@ -0,0 +1,120 @@
+package grange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// A Graph describes how clusters refer to each other, as found by parsing
+// their values. See State.Graph.
+type Graph struct {
+	// Every cluster, and any cluster that is referred to but does not exist,
+	// sorted by name.
+	Nodes []string `json:"nodes"`
+	Edges []Edge   `json:"edges"`
+}
+
+// An Edge is a reference from a value at a key of one cluster to another
+// cluster. To is empty if the reference could be to any cluster, such as
+// has(TYPE;redis). Kind is as described for Reference.
+type Edge struct {
+	From  string `json:"from"`
+	Key   string `json:"key"`
+	To    string `json:"to"`
+	ToKey string `json:"to_key"`
+	Kind  string `json:"kind"`
+}
+
+// Label describes the edge by its key and kind, followed by the key it refers
+// to unless that is CLUSTER, such as "CLUSTER %:DOWN" for %dc1:DOWN in a
+// CLUSTER value.
+func (e Edge) Label() string {
+	label := e.Key + " " + e.Kind
+	if e.ToKey != "" && e.ToKey != "CLUSTER" {
+		label += ":" + e.ToKey
+	}
+	return label
+}
+
+// Graph returns the references between clusters. References from several
+// values of a key to the same place are combined into one edge.
+func (state *State) Graph() (Graph, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	clusters, err := state.allClusters()
+	if err != nil {
+		return Graph{}, err
+	}
+	refs, err := state.references(nil)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	nodes := map[string]bool{}
+	for name := range clusters {
+		nodes[name] = true
+	}
+
+	graph := Graph{Nodes: []string{}, Edges: []Edge{}}
+	seen := map[Edge]bool{}
+	for _, ref := range refs {
+		edge := Edge{ref.Cluster, ref.Key, ref.Target, ref.TargetKey, ref.Kind}
+		if !seen[edge] {
+			seen[edge] = true
+			graph.Edges = append(graph.Edges, edge)
+		}
+		if ref.Target != "" {
+			nodes[ref.Target] = true
+		}
+	}
+
+	for name := range nodes {
+		graph.Nodes = append(graph.Nodes, name)
+	}
+	sort.Strings(graph.Nodes)
+	return graph, nil
+}
+
+// The DOT node for references that could be to any cluster. Parentheses
+// cannot appear in a cluster name used in a query.
+const wildcardNode = `"(any)"`
+
+// WriteDOT writes the graph in Graphviz's DOT language. References that could
+// be to any cluster point to a separate node labeled "*".
+func (g Graph) WriteDOT(w io.Writer) error {
+	lines := []string{"digraph clusters {"}
+	for _, node := range g.Nodes {
+		lines = append(lines, fmt.Sprintf("  %s;", strconv.Quote(node)))
+	}
+
+	wildcard := false
+	for _, edge := range g.Edges {
+		to := strconv.Quote(edge.To)
+		if edge.To == "" {
+			to = wildcardNode
+			wildcard = true
+		}
+		lines = append(lines, fmt.Sprintf("  %s -> %s [label=%s];",
+			strconv.Quote(edge.From), to, strconv.Quote(edge.Label())))
+	}
+	if wildcard {
+		lines = append(lines, fmt.Sprintf(`  %s [label="*", shape=box, style=dashed];`, wildcardNode))
+	}
+	lines = append(lines, "}")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the graph as a JSON object with nodes and edges fields.
+func (g Graph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g)
+}
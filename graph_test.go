@@ -0,0 +1,79 @@
+package grange
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	state := graphState()
+	graph, err := state.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Graph{
+		Nodes: []string{"GROUPS", "a", "b", "c"},
+		Edges: []Edge{
+			{"GROUPS", "web", "GROUPS", "db", "@"},
+			{"b", "CLUSTER", "a", "CLUSTER", "%"},
+			{"b", "CLUSTER", "a", "DOWN", "%"},
+			{"b", "CLUSTER", "c", "CLUSTER", "%"},
+			{"c", "CLUSTER", "c", "X", "$"},
+			{"c", "CLUSTER", "", "TYPE", "has()"},
+			{"c", "X", "", "CLUSTER", "clusters()"},
+		},
+	}
+	if !reflect.DeepEqual(graph, expected) {
+		t.Errorf("Graph\n got: %v\nwant: %v", graph, expected)
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	state := singleCluster("a", Cluster{"CLUSTER": []string{"%b:DOWN", "has(T;v)"}})
+	graph, _ := state.Graph()
+
+	var out bytes.Buffer
+	if err := graph.WriteDOT(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `digraph clusters {
+  "a";
+  "b";
+  "a" -> "b" [label="CLUSTER %:DOWN"];
+  "a" -> "(any)" [label="CLUSTER has():T"];
+  "(any)" [label="*", shape=box, style=dashed];
+}
+`
+	if out.String() != expected {
+		t.Errorf("WriteDOT\n got: %s\nwant: %s", out.String(), expected)
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	state := graphState()
+	graph, _ := state.Graph()
+
+	var out bytes.Buffer
+	if err := graph.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Graph
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, graph) {
+		t.Errorf("WriteJSON round trip\n got: %v\nwant: %v", decoded, graph)
+	}
+
+	var fields map[string][]map[string]interface{}
+	json.Unmarshal(out.Bytes(), &fields)
+	edge := map[string]interface{}{"from": "GROUPS", "key": "web", "to": "GROUPS", "to_key": "db", "kind": "@"}
+	if !reflect.DeepEqual(fields["edges"][0], edge) {
+		t.Errorf("Unexpected JSON edge: %v", fields["edges"][0])
+	}
+}
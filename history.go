@@ -0,0 +1,313 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A Version is a state's clusters after a change made with AddCluster or
+// RemoveCluster. See SetHistory.
+type Version struct {
+	Number  uint64
+	Time    time.Time
+	Cluster string // The cluster that changed, empty for the oldest version.
+	Removed bool
+}
+
+// A ClusterDiff lists the keys of a cluster that were added, removed or
+// changed between two versions.
+type ClusterDiff struct {
+	Cluster string
+	Keys    []string
+}
+
+// history is an append-only log of changes, starting from a copy of the
+// clusters as of the oldest version retained.
+type history struct {
+	versions int
+	maxAge   time.Duration
+	now      func() time.Time
+
+	base        map[string]Cluster
+	baseVersion uint64
+	baseTime    time.Time
+	changes     []change
+}
+
+type change struct {
+	version uint64
+	time    time.Time
+	name    string
+	cluster Cluster // nil when the cluster was removed.
+}
+
+// SetHistory keeps previous versions of the state's clusters, so that they
+// can be queried with QueryAt and QueryAsOf and compared with Diff. The last
+// versions changes are retained, and if maxAge is not zero, changes older
+// than that are discarded once a newer change is made, though the state as it
+// was maxAge ago remains available. A versions of zero disables history.
+//
+// Clusters are not copied, so must not be modified after they are added.
+// Clusters loaded from a ClusterSource are not part of the history.
+func (state *State) SetHistory(versions int, maxAge time.Duration) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if versions <= 0 {
+		state.history = nil
+		return
+	}
+
+	if state.history == nil {
+		h := &history{now: time.Now, base: map[string]Cluster{}, baseVersion: state.version}
+		for name, c := range state.clusters {
+			if !state.loaded[name] {
+				h.base[name] = c
+			}
+		}
+		h.baseTime = h.now()
+		state.history = h
+	}
+	state.history.versions = versions
+	state.history.maxAge = maxAge
+	state.history.trim(state.history.now())
+}
+
+// Version returns the number of the current version of the state's clusters,
+// which is incremented by each call to AddCluster and RemoveCluster.
+func (state *State) Version() uint64 {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.version
+}
+
+// Versions returns the versions that are retained, oldest first.
+func (state *State) Versions() []Version {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	h := state.history
+	if h == nil {
+		return []Version{}
+	}
+
+	versions := []Version{{Number: h.baseVersion, Time: h.baseTime}}
+	for _, c := range h.changes {
+		versions = append(versions, Version{c.version, c.time, c.name, c.cluster == nil})
+	}
+	return versions
+}
+
+// VersionAt returns the version that was current at the given time, the last
+// made at or before it.
+func (state *State) VersionAt(t time.Time) (uint64, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.versionAt(t)
+}
+
+func (state *State) versionAt(t time.Time) (uint64, error) {
+	h := state.history
+	if h == nil {
+		return 0, errors.New("History is not enabled, see SetHistory")
+	}
+	if t.Before(h.baseTime) {
+		return 0, errors.New(fmt.Sprintf("No version retained at %s", t))
+	}
+
+	version := h.baseVersion
+	for _, c := range h.changes {
+		if c.time.After(t) {
+			break
+		}
+		version = c.version
+	}
+	return version, nil
+}
+
+// StateAt returns a new state with the clusters as they were at the given
+// version, and the same settings as this state.
+func (state *State) StateAt(version uint64) (State, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.stateAt(version)
+}
+
+func (state *State) stateAt(version uint64) (State, error) {
+	clusters, err := state.clustersAt(version)
+	if err != nil {
+		return NewState(), err
+	}
+
+	old := NewState()
+	old.SetCaseInsensitive(state.caseInsensitive)
+	old.SetUnicodeIdentifiers(state.unicodeIdentifiers)
+	old.SetDefaultCluster(state.defaultCluster)
+	old.SetUniverseKey(state.universeKey)
+	for name, c := range clusters {
+		old.AddCluster(name, c)
+	}
+	old.version = version
+	return old, nil
+}
+
+// QueryAt evaluates a query against the clusters as they were at the given
+// version. Use QueryAsOf to query the state as it was at a point in time.
+func (state *State) QueryAt(version uint64, input string) (Result, error) {
+	old, err := state.StateAt(version)
+	if err != nil {
+		return NewResult(), err
+	}
+	return old.Query(input)
+}
+
+// QueryAsOf evaluates a query against the clusters as they were at the given
+// time, that is the last version made at or before it:
+//
+//	result, err := state.QueryAsOf(yesterday, "%web-prod")
+//
+// It is an error if the time is before the oldest version retained.
+func (state *State) QueryAsOf(t time.Time, input string) (Result, error) {
+	state.mutex.RLock()
+	version, err := state.versionAt(t)
+	var old State
+	if err == nil {
+		old, err = state.stateAt(version)
+	}
+	state.mutex.RUnlock()
+
+	if err != nil {
+		return NewResult(), err
+	}
+	return old.Query(input)
+}
+
+// Diff lists the clusters that changed between two versions, sorted by name.
+func (state *State) Diff(from uint64, to uint64) ([]ClusterDiff, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	before, err := state.clustersAt(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := state.clustersAt(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	diffs := []ClusterDiff{}
+	for name := range names {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		keys := changedKeys(b, a)
+		if len(keys) > 0 || inBefore != inAfter {
+			diffs = append(diffs, ClusterDiff{name, keys})
+		}
+	}
+	sort.Sort(clusterDiffs(diffs))
+	return diffs, nil
+}
+
+// changedKeys returns the sorted keys that differ between two versions of a
+// cluster.
+func changedKeys(before Cluster, after Cluster) []string {
+	keys := []string{}
+	for key, values := range before {
+		if other, ok := after[key]; !ok || !equalValues(values, other) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type clusterDiffs []ClusterDiff
+
+func (d clusterDiffs) Len() int           { return len(d) }
+func (d clusterDiffs) Less(i, j int) bool { return d[i].Cluster < d[j].Cluster }
+func (d clusterDiffs) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// record notes a change to a cluster, c being nil if it was removed.
+func (state *State) record(name string, c Cluster) {
+	state.version++
+	if h := state.history; h != nil {
+		now := h.now()
+		h.changes = append(h.changes, change{state.version, now, name, c})
+		h.trim(now)
+	}
+}
+
+func (state *State) clustersAt(version uint64) (map[string]Cluster, error) {
+	h := state.history
+	if h == nil {
+		return nil, errors.New("History is not enabled, see SetHistory")
+	}
+	if version < h.baseVersion {
+		return nil, errors.New(fmt.Sprintf("Version %d is no longer retained", version))
+	}
+	if version > state.version {
+		return nil, errors.New(fmt.Sprintf("Version %d does not exist", version))
+	}
+
+	clusters := map[string]Cluster{}
+	for name, c := range h.base {
+		clusters[name] = c
+	}
+	for _, c := range h.changes {
+		if c.version > version {
+			break
+		}
+		apply(clusters, c)
+	}
+	return clusters, nil
+}
+
+// trim discards changes beyond the retention limits by applying them to the
+// base.
+func (h *history) trim(now time.Time) {
+	cutoff := now.Add(-h.maxAge)
+	for len(h.changes) > 0 &&
+		(len(h.changes) > h.versions || h.maxAge > 0 && h.changes[0].time.Before(cutoff)) {
+
+		c := h.changes[0]
+		apply(h.base, c)
+		h.baseVersion, h.baseTime = c.version, c.time
+		h.changes = h.changes[1:]
+	}
+}
+
+func apply(clusters map[string]Cluster, c change) {
+	if c.cluster == nil {
+		delete(clusters, c.name)
+	} else {
+		clusters[c.name] = c.cluster
+	}
+}
@@ -0,0 +1,182 @@
+package grange
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// historyState returns a state with history enabled and a clock that
+// advances a minute each time it is read.
+func historyState(versions int, maxAge time.Duration) (*State, time.Time) {
+	start := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	state := NewState()
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"x"}})
+	state.SetHistory(versions, maxAge)
+	state.history.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	state.history.baseTime = start
+	return &state, start
+}
+
+func TestQueryAt(t *testing.T) {
+	state, start := historyState(10, 0)
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"x", "z"}})     // 2, 00:01
+	state.AddCluster("b", Cluster{"CLUSTER": []string{"%a"}})         // 3, 00:02
+	state.RemoveCluster("a")                                          // 4, 00:03
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"w"}, "K": {}}) // 5, 00:04
+
+	tests := []struct {
+		version  uint64
+		expected Result
+	}{
+		{1, NewResult()},
+		{2, NewResult()},
+		{3, NewResult("x", "z")},
+		{4, NewResult()},
+		{5, NewResult("w")},
+	}
+	for _, test := range tests {
+		result, err := state.QueryAt(test.version, "%b")
+		if err != nil {
+			t.Errorf("QueryAt(%d) returned error: %s", test.version, err)
+		} else if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("QueryAt(%d)\n got: %v\nwant: %v", test.version, result, test.expected)
+		}
+	}
+	testEval(t, NewResult("x"), "%a", mustStateAt(t, state, 1))
+
+	if _, err := state.QueryAt(6, "%a"); err == nil {
+		t.Errorf("Expected error for future version")
+	}
+
+	times := map[time.Duration]uint64{0: 1, 90 * time.Second: 2, 4 * time.Minute: 5, time.Hour: 5}
+	for offset, expected := range times {
+		version, err := state.VersionAt(start.Add(offset))
+		if err != nil || version != expected {
+			t.Errorf("VersionAt(+%s)\n got: %d %v\nwant: %d", offset, version, err, expected)
+		}
+	}
+	if _, err := state.VersionAt(start.Add(-time.Second)); err == nil {
+		t.Errorf("Expected error for time before history")
+	}
+}
+
+func TestQueryAsOf(t *testing.T) {
+	state, start := historyState(10, 0)
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"y"}}) // 2, 00:01
+	state.RemoveCluster("a")                                 // 3, 00:02
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"z"}}) // 4, 00:03
+
+	tests := []struct {
+		offset   time.Duration
+		expected Result
+	}{
+		{0, NewResult("x")},                             // At the oldest version.
+		{time.Minute - time.Nanosecond, NewResult("x")}, // Just before a change.
+		{time.Minute, NewResult("y")},                   // At a change.
+		{90 * time.Second, NewResult("y")},              // Between changes.
+		{2 * time.Minute, NewResult()},                  // At a removal.
+		{3 * time.Minute, NewResult("z")},               // At the last change.
+		{time.Hour, NewResult("z")},                     // After the last change.
+	}
+	for _, test := range tests {
+		result, err := state.QueryAsOf(start.Add(test.offset), "%a")
+		if err != nil {
+			t.Errorf("QueryAsOf(+%s) returned error: %s", test.offset, err)
+		} else if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("QueryAsOf(+%s)\n got: %v\nwant: %v", test.offset, result, test.expected)
+		}
+	}
+
+	if _, err := state.QueryAsOf(start.Add(-time.Nanosecond), "%a"); err == nil {
+		t.Errorf("Expected error for time before history")
+	}
+
+	// Once the oldest versions are discarded, times before the oldest one
+	// retained, version 3 at 00:02, are errors.
+	state.SetHistory(1, 0)
+	if _, err := state.QueryAsOf(start.Add(2*time.Minute-time.Nanosecond), "%a"); err == nil {
+		t.Errorf("Expected error for time before the oldest version retained")
+	}
+	for offset, expected := range map[time.Duration]Result{2 * time.Minute: NewResult(), time.Hour: NewResult("z")} {
+		result, err := state.QueryAsOf(start.Add(offset), "%a")
+		if err != nil || !reflect.DeepEqual(result, expected) {
+			t.Errorf("QueryAsOf(+%s) after discarding\n got: %v %v\nwant: %v", offset, result, err, expected)
+		}
+	}
+
+	state.SetHistory(0, 0)
+	if _, err := state.QueryAsOf(start, "%a"); err == nil {
+		t.Errorf("Expected error with history disabled")
+	}
+}
+
+func mustStateAt(t *testing.T, state *State, version uint64) *State {
+	old, err := state.StateAt(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &old
+}
+
+func TestDiff(t *testing.T) {
+	state, _ := historyState(10, 0)
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"x", "z"}, "K": {"v"}})
+	state.AddCluster("b", Cluster{})
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"x", "z"}, "L": {"v"}})
+
+	diff, err := state.Diff(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ClusterDiff{{"a", []string{"CLUSTER", "L"}}, {"b", []string{}}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Diff\n got: %v\nwant: %v", diff, expected)
+	}
+
+	diff, _ = state.Diff(2, 4)
+	expected = []ClusterDiff{{"a", []string{"K", "L"}}, {"b", []string{}}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Diff\n got: %v\nwant: %v", diff, expected)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	state, start := historyState(2, 0)
+	for _, value := range []string{"v", "w", "z"} {
+		state.AddCluster("a", Cluster{"CLUSTER": []string{value}})
+	}
+
+	versions := []Version{
+		{2, start.Add(time.Minute), "", false},
+		{3, start.Add(2 * time.Minute), "a", false},
+		{4, start.Add(3 * time.Minute), "a", false},
+	}
+	if !reflect.DeepEqual(state.Versions(), versions) {
+		t.Errorf("Versions\n got: %v\nwant: %v", state.Versions(), versions)
+	}
+	if _, err := state.QueryAt(1, "%a"); err == nil {
+		t.Errorf("Expected error for discarded version")
+	}
+	testEval(t, NewResult("v"), "%a", mustStateAt(t, state, 2))
+
+	// The state as it was maxAge ago is kept.
+	state, start = historyState(10, 150*time.Second)
+	state.AddCluster("b", Cluster{}) // 00:01, discarded at 00:04
+	state.AddCluster("c", Cluster{}) // 00:02
+	state.RemoveCluster("b")         // 00:03
+	state.AddCluster("d", Cluster{}) // 00:04
+	if versions := state.Versions(); len(versions) != 4 || versions[0].Number != 2 {
+		t.Errorf("Unexpected versions: %v", versions)
+	}
+
+	state.SetHistory(0, 0)
+	if _, err := state.QueryAt(4, "%a"); err == nil {
+		t.Errorf("Expected error with history disabled")
+	}
+}
@@ -0,0 +1,226 @@
+package grange
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MemoStats describes the use of a state's memo cache. See SetMemoLimit.
+type MemoStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int
+}
+
+// HitRate returns the fraction of lookups that were hits, or zero if there
+// have been none.
+func (s MemoStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// memo caches the results of subexpressions of queries, keyed by their
+// canonical form, least recently used first out once over its limit.
+type memo struct {
+	mutex   sync.Mutex
+	limit   int
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   MemoStats
+}
+
+type memoEntry struct {
+	key     string
+	version uint64
+	result  Result
+	size    int
+}
+
+// Rough per-entry and per-value overheads of maps, list elements, sets and
+// strings, so that many small values are not undercounted.
+const (
+	memoEntryOverhead = 128
+	memoValueOverhead = 48
+)
+
+// SetMemoLimit enables caching the results of subexpressions of queries, such
+// as has(TYPE;redis) or %{...} & ..., using up to roughly the given number of
+// bytes. This helps when the same queries, or queries with parts in common,
+// are issued over and over. Cached results are discarded whenever clusters
+// change. A limit of zero disables the cache.
+//
+// Results of cluster keys are always cached, see PrimeCache.
+func (state *State) SetMemoLimit(bytes int) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if bytes <= 0 {
+		state.memo = nil
+		return
+	}
+	if state.memo == nil {
+		state.memo = &memo{entries: map[string]*list.Element{}, lru: list.New()}
+	}
+	state.memo.limit = bytes
+	state.memo.evict()
+}
+
+// MemoStats returns statistics for the memo cache, or zero values if it is
+// not enabled.
+func (state *State) MemoStats() MemoStats {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	if state.memo == nil {
+		return MemoStats{}
+	}
+	state.memo.mutex.Lock()
+	defer state.memo.mutex.Unlock()
+	return state.memo.stats
+}
+
+func (m *memo) get(key string, version uint64) (Result, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		entry := e.Value.(*memoEntry)
+		if entry.version == version {
+			m.lru.MoveToFront(e)
+			m.stats.Hits++
+			return entry.result, true
+		}
+		m.remove(e)
+	}
+	m.stats.Misses++
+	return Result{}, false
+}
+
+func (m *memo) put(key string, version uint64, result Result) {
+	size := memoEntryOverhead + len(key)
+	for x := range result.Iter() {
+		size += memoValueOverhead + len(x.(string))
+	}
+	if size > m.limit {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	m.entries[key] = m.lru.PushFront(&memoEntry{key, version, result, size})
+	m.stats.Entries++
+	m.stats.Bytes += size
+	m.evict()
+}
+
+// reset discards every entry, for changes to a state that do not change its
+// version.
+func (m *memo) reset() {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries = map[string]*list.Element{}
+	m.lru.Init()
+	m.stats.Entries, m.stats.Bytes = 0, 0
+}
+
+func (m *memo) evict() {
+	for m.stats.Bytes > m.limit {
+		m.remove(m.lru.Back())
+		m.stats.Evictions++
+	}
+}
+
+func (m *memo) remove(e *list.Element) {
+	entry := m.lru.Remove(e).(*memoEntry)
+	delete(m.entries, entry.key)
+	m.stats.Entries--
+	m.stats.Bytes -= entry.size
+}
+
+// nodeMemo evaluates a subexpression of a query through the memo cache.
+type nodeMemo struct {
+	node parserNode
+	key  string
+}
+
+func (n nodeMemo) String() string {
+	return n.key
+}
+
+func (n nodeMemo) visit(state *State, context *evalContext) error {
+	// Results only depend on the expression at the top level of a query. A
+	// cluster lookup sets the current cluster for following expressions, and
+	// regexes depend on the result they are filtering.
+	if context.currentClusterName != "" || context.workingResult != nil {
+		return n.node.(evalNode).visit(state, context)
+	}
+
+	result, ok := state.memo.get(n.key, state.version)
+	if ok {
+		context.charge(costNode, 1)
+	} else {
+		subContext := context.sub()
+		if err := n.node.(evalNode).visit(state, &subContext); err != nil {
+			return err
+		}
+		if err := subContext.costErr(); err != nil {
+			return err
+		}
+		result = subContext.currentResult
+		state.memo.put(n.key, state.version, result)
+	}
+
+	for x := range result.Iter() {
+		context.addResult(x.(string))
+	}
+	return nil
+}
+
+// memoize wraps the subexpressions of a query that are worth caching, those
+// that do more than look up a single value, in nodeMemo.
+func memoize(node parserNode) parserNode {
+	key := node.String()
+
+	switch n := node.(type) {
+	case nodeOperator:
+		n.left, n.right = memoize(n.left), memoize(n.right)
+		if n.op == operatorUnion {
+			// Unions pass their context through, see nodeMemo.visit.
+			return n
+		}
+		return nodeMemo{n, key}
+	case nodeFunction:
+		params := []parserNode{}
+		for _, param := range n.params {
+			params = append(params, memoize(param))
+		}
+		n.params = params
+		return nodeMemo{n, key}
+	case nodeComplement:
+		n.node = memoize(n.node)
+		return nodeMemo{n, key}
+	case nodeGroupQuery:
+		n.node = memoize(n.node)
+		return nodeMemo{n, key}
+	case nodeClusterLookup:
+		n.node, n.key = memoize(n.node), memoize(n.key)
+		return n
+	case nodeBraces:
+		n.left, n.node, n.right = memoize(n.left), memoize(n.node), memoize(n.right)
+		return n
+	}
+	return node
+}
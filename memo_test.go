@@ -0,0 +1,110 @@
+package grange
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var memoQueries = []string{
+	"has(TYPE;redis)",
+	"%{has(TYPE;redis)}",
+	"%{has(TYPE;redis)} - %b",
+	"%a & /1/, /db/",
+	"%a, $X",
+	"(%a - web1), $X",
+	"!%b",
+	"?web1",
+	"count(%a - web1)",
+	"%{has(TYPE;/sql/)}:{CLUSTER,TYPE} ^ %a",
+}
+
+func TestMemoMatchesQuery(t *testing.T) {
+	plain := memoState()
+	memoized := memoState()
+	memoized.SetMemoLimit(1 << 20)
+
+	for i := 0; i < 2; i++ {
+		for _, query := range memoQueries {
+			expected, err := plain.Query(query)
+			if err != nil {
+				t.Fatalf("Query(%s) returned error: %s", query, err)
+			}
+			testEval(t, expected, query, memoized)
+		}
+	}
+
+	stats := memoized.MemoStats()
+	if stats.Hits == 0 || stats.Misses == 0 || stats.Entries == 0 || stats.Bytes == 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if rate := stats.HitRate(); rate < 0.5 || rate >= 1 {
+		t.Errorf("Unexpected hit rate %f for %+v", rate, stats)
+	}
+}
+
+func TestMemoInvalidation(t *testing.T) {
+	state := memoState()
+	state.SetMemoLimit(1 << 20)
+
+	testEval(t, NewResult("a"), "has(TYPE;redis)", state)
+	state.AddCluster("c", Cluster{"TYPE": []string{"redis"}})
+	testEval(t, NewResult("a", "c"), "has(TYPE;redis)", state)
+	state.RemoveCluster("a")
+	testEval(t, NewResult("c"), "has(TYPE;redis)", state)
+
+	testEval(t, NewResult("web1", "web2", "web3", "web4"), "!db1", state)
+	state.SetUniverseKey("db")
+	testEval(t, NewResult(), "!db1", state)
+
+	if hits := state.MemoStats().Hits; hits != 0 {
+		t.Errorf("Expected no hits after changes, got %d", hits)
+	}
+
+	state.SetMemoLimit(0)
+	testEval(t, NewResult("c"), "has(TYPE;redis)", state)
+	if stats := state.MemoStats(); !reflect.DeepEqual(stats, MemoStats{}) {
+		t.Errorf("Expected empty stats when disabled, got %+v", stats)
+	}
+}
+
+func TestMemoLimit(t *testing.T) {
+	state := memoState()
+	state.SetMemoLimit(3 * memoEntryOverhead)
+
+	for _, query := range memoQueries {
+		state.Query(query)
+	}
+
+	stats := state.MemoStats()
+	if stats.Bytes > 3*memoEntryOverhead || stats.Evictions == 0 {
+		t.Errorf("Expected entries to be evicted, got %+v", stats)
+	}
+
+	state.SetMemoLimit(1)
+	if stats := state.MemoStats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Expected all entries to be evicted, got %+v", stats)
+	}
+}
+
+func TestMemoConcurrentQueries(t *testing.T) {
+	state := memoState()
+	state.SetMemoLimit(1 << 20)
+	state.PrimeCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, query := range memoQueries {
+					if _, err := state.Query(query); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -11,6 +11,7 @@ const (
 	operatorIntersect operatorType = iota
 	operatorSubtract
 	operatorUnion
+	operatorSymmetricDifference
 )
 
 type parserNode interface {
@@ -19,10 +20,6 @@ type parserNode interface {
 
 type nodeNull struct{}
 
-// Transient marker node to delineate the start of a braces capture. This is
-// kind of weird. This node should never be present one parsing is complete.
-type nodeBraceStart struct{}
-
 type nodeText struct {
 	val string
 }
@@ -43,6 +40,11 @@ type nodeGroupQuery struct {
 	node parserNode
 }
 
+// Everything in the state's universe that is not in node.
+type nodeComplement struct {
+	node parserNode
+}
+
 type nodeClusterLookup struct {
 	node parserNode
 	key  parserNode
@@ -54,6 +56,8 @@ type nodeOperator struct {
 	right parserNode
 }
 
+// Expands to every combination of left, node and right concatenated, where
+// node is the part inside the braces.
 type nodeBraces struct {
 	node  parserNode
 	left  parserNode
@@ -79,55 +83,135 @@ func (n nodeText) String() string {
 }
 
 func (n nodeConstant) String() string {
-	return n.val
+	return quote(n.val)
 }
 
 func (n nodeRegexp) String() string {
 	return fmt.Sprintf("/%s/", n.val)
 }
 
+// String writes the cluster name in braces, unless it already is a single
+// pair of them such as %{a}, which would otherwise gain another pair each
+// time it was parsed.
 func (n nodeClusterLookup) String() string {
+	name := fmt.Sprintf("{%s}", n.node)
+	if b, ok := n.node.(nodeBraces); ok && isNull(b.left) && isNull(b.right) {
+		name = b.String()
+	}
+
 	switch n.key.(type) {
 	case nodeText:
 		if n.key.(nodeText).val == "CLUSTER" {
-			return fmt.Sprintf("%%{%s}", n.node)
+			return "%" + name
+		}
+	case nodeConstant:
+		if n.key.(nodeConstant).val == "CLUSTER" {
+			return "%" + name
 		}
 	}
-	return fmt.Sprintf("%%{%s}:%s", n.node, n.key)
+	return fmt.Sprintf("%%%s:%s", name, bracket(n.key))
 }
 
 func (n nodeGroupQuery) String() string {
-	return fmt.Sprintf("?%s", n.node)
+	return fmt.Sprintf("?%s", bracket(n.node))
+}
+
+func (n nodeComplement) String() string {
+	return fmt.Sprintf("!%s", bracket(n.node))
 }
 
 func (n nodeLocalClusterLookup) String() string {
 	return fmt.Sprintf("$%s", n.key)
 }
 
+// String leaves out missing parts rather than writing them as (). The left
+// side is everything before the braces, so needs brackets if it is a binary
+// operator, or if the braces would be parsed as part of it.
 func (n nodeBraces) String() string {
-	return fmt.Sprintf("%s{%s}%s", n.node, n.left, n.right)
+	left, node, right := "", "", ""
+	switch n.left.(type) {
+	case nodeNull:
+	case nodeOperator:
+		left = fmt.Sprintf("(%s)", n.left)
+	default:
+		left = n.left.String()
+		if absorbsBraces(n.left) {
+			left = "(" + left + ")"
+		}
+	}
+	if !isNull(n.node) {
+		node = n.node.String()
+	}
+	if !isNull(n.right) {
+		right = bracket(n.right)
+	}
+	return fmt.Sprintf("%s{%s}%s", left, node, right)
 }
 
-func (n nodeNull) String() string {
-	return ""
+// absorbsBraces reports whether braces written after the string for n would
+// be parsed as part of n, rather than expanding it. This is the case when it
+// ends with braces that have nothing after them, such as %{a} or !{a,b}.
+func absorbsBraces(n parserNode) bool {
+	switch n := n.(type) {
+	case nodeBraces:
+		if isNull(n.right) {
+			return true
+		}
+		return !isBracketed(n.right) && absorbsBraces(n.right)
+	case nodeComplement:
+		return !isBracketed(n.node) && absorbsBraces(n.node)
+	case nodeGroupQuery:
+		return !isBracketed(n.node) && absorbsBraces(n.node)
+	case nodeClusterLookup:
+		switch key := n.key.(type) {
+		case nodeText:
+			return key.val == "CLUSTER" || absorbsBraces(key)
+		case nodeConstant:
+			return key.val == "CLUSTER" || absorbsBraces(key)
+		}
+		return !isBracketed(n.key) && absorbsBraces(n.key)
+	}
+	return false
+}
+
+func isNull(n parserNode) bool {
+	_, ok := n.(nodeNull)
+	return ok
+}
+
+// isBracketed reports whether bracket adds brackets around n.
+func isBracketed(n parserNode) bool {
+	switch n := n.(type) {
+	case nodeOperator:
+		return true
+	case nodeBraces:
+		return !isNull(n.left)
+	}
+	return false
 }
 
-func (n nodeBraceStart) String() string {
-	return ""
+// String is (), so that an empty operand such as the right side of b,()
+// parses back.
+func (n nodeNull) String() string {
+	return "()"
 }
 
+// String adds brackets around operands where needed so that the result parses
+// back to an equivalent tree. Operators all have the same precedence and are
+// left associative, so only the right side ever needs them.
 func (n nodeOperator) String() string {
-	var op string
+	return fmt.Sprintf("%s %s %s", n.left, n.op, bracket(n.right))
+}
 
-	switch n.op {
-	case operatorIntersect:
-		op = "&"
-	case operatorSubtract:
-		op = "-"
-	case operatorUnion:
-		op = ","
+// bracket returns the string for a node used as a single operand, such as of
+// a prefix operator or the right side of a binary operator. Operators and
+// brace expansions with a left side would otherwise take in what comes before
+// them when parsed, so are bracketed.
+func bracket(n parserNode) string {
+	if isBracketed(n) {
+		return fmt.Sprintf("(%s)", n)
 	}
-	return fmt.Sprintf("%s %s %s", n.left, op, n.right)
+	return n.String()
 }
 
 func (t operatorType) String() string {
@@ -138,6 +222,8 @@ func (t operatorType) String() string {
 		return "-"
 	case operatorUnion:
 		return ","
+	case operatorSymmetricDifference:
+		return "^"
 	default:
 		panic("Unknown operatorType")
 	}
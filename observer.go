@@ -0,0 +1,129 @@
+package grange
+
+import (
+	"expvar"
+	"time"
+)
+
+// An Observer receives events from a state, such as to record metrics. See
+// SetObserver.
+//
+// Methods are called synchronously while the state is locked, including from
+// concurrent queries, so they must be fast, safe for concurrent use, and must
+// not call back into the state. Embed NopObserver to only implement some of
+// them.
+type Observer interface {
+	// QueryStart and QueryEnd are called around every call to Query, with the
+	// number of values returned and any error.
+	QueryStart(query string)
+	QueryEnd(query string, duration time.Duration, cardinality int, err error)
+
+	// ParseError is called when a query fails because it, or a cluster value
+	// it uses, could not be parsed. It is called after QueryEnd.
+	ParseError(query string, err error)
+
+	// Truncated is called when the result of an expression is cut short at
+	// MaxResults. The expression is the query or a cluster value it uses.
+	Truncated(expr string)
+
+	// RecursionLimit is called when evaluating an expression exceeds
+	// MaxQueryDepth, usually because of a cycle between clusters.
+	RecursionLimit(expr string)
+
+	// CacheHit and CacheMiss are called when the values of a cluster key are
+	// looked up, depending on whether they had already been computed.
+	CacheHit(cluster string, key string)
+	CacheMiss(cluster string, key string)
+
+	// PrimeProgress is called by PrimeCache after each key is computed, with
+	// the number done so far out of the total.
+	PrimeProgress(done int, total int)
+}
+
+// SetObserver sets an observer to receive events from the state, or removes
+// it if nil.
+func (state *State) SetObserver(observer Observer) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.observer = observer
+}
+
+// NopObserver ignores every event. It is intended to be embedded in
+// observers that are only interested in some events.
+type NopObserver struct{}
+
+func (NopObserver) QueryStart(query string)                                                   {}
+func (NopObserver) QueryEnd(query string, duration time.Duration, cardinality int, err error) {}
+func (NopObserver) ParseError(query string, err error)                                        {}
+func (NopObserver) Truncated(expr string)                                                     {}
+func (NopObserver) RecursionLimit(expr string)                                                {}
+func (NopObserver) CacheHit(cluster string, key string)                                       {}
+func (NopObserver) CacheMiss(cluster string, key string)                                      {}
+func (NopObserver) PrimeProgress(done int, total int)                                         {}
+
+// ExpvarObserver counts events in an expvar.Map, so that they are served
+// from /debug/vars along with other expvar metrics. The counters are:
+//
+//	queries          queries run
+//	query_errors     queries that returned an error
+//	query_nanos      total time spent in queries
+//	results          total values returned by queries
+//	parse_errors     queries that failed to parse
+//	truncations      results cut short at MaxResults
+//	recursion_limits expressions that exceeded MaxQueryDepth
+//	cache_hits       cluster keys found already computed
+//	cache_misses     cluster keys that had to be computed
+//	prime_done       keys computed by the last PrimeCache
+//	prime_total      keys to compute in the last PrimeCache
+//
+// Other monitoring systems can be fed by reading the map periodically.
+type ExpvarObserver struct {
+	Map *expvar.Map
+}
+
+// NewExpvarObserver publishes a new map with the given name. Like
+// expvar.NewMap, it panics if the name is already in use.
+func NewExpvarObserver(name string) *ExpvarObserver {
+	return &ExpvarObserver{expvar.NewMap(name)}
+}
+
+func (o *ExpvarObserver) QueryStart(query string) {}
+
+func (o *ExpvarObserver) QueryEnd(query string, duration time.Duration, cardinality int, err error) {
+	o.Map.Add("queries", 1)
+	o.Map.Add("query_nanos", int64(duration))
+	o.Map.Add("results", int64(cardinality))
+	if err != nil {
+		o.Map.Add("query_errors", 1)
+	}
+}
+
+func (o *ExpvarObserver) ParseError(query string, err error) {
+	o.Map.Add("parse_errors", 1)
+}
+
+func (o *ExpvarObserver) Truncated(expr string) {
+	o.Map.Add("truncations", 1)
+}
+
+func (o *ExpvarObserver) RecursionLimit(expr string) {
+	o.Map.Add("recursion_limits", 1)
+}
+
+func (o *ExpvarObserver) CacheHit(cluster string, key string) {
+	o.Map.Add("cache_hits", 1)
+}
+
+func (o *ExpvarObserver) CacheMiss(cluster string, key string) {
+	o.Map.Add("cache_misses", 1)
+}
+
+func (o *ExpvarObserver) PrimeProgress(done int, total int) {
+	progress := new(expvar.Int)
+	progress.Set(int64(done))
+	o.Map.Set("prime_done", progress)
+
+	size := new(expvar.Int)
+	size.Set(int64(total))
+	o.Map.Set("prime_total", size)
+}
@@ -0,0 +1,140 @@
+package grange
+
+import (
+	"expvar"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	NopObserver
+	mutex  sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(event string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) take() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	events := o.events
+	o.events = nil
+	return events
+}
+
+func (o *recordingObserver) QueryStart(query string) {
+	o.record("start " + query)
+}
+
+func (o *recordingObserver) QueryEnd(query string, duration time.Duration, cardinality int, err error) {
+	o.record("end " + query)
+}
+
+func (o *recordingObserver) ParseError(query string, err error) {
+	o.record("parse error " + query)
+}
+
+func (o *recordingObserver) Truncated(expr string) {
+	o.record("truncated " + expr)
+}
+
+func (o *recordingObserver) RecursionLimit(expr string) {
+	o.record("recursion " + expr)
+}
+
+func (o *recordingObserver) CacheHit(cluster string, key string) {
+	o.record("hit " + cluster + ":" + key)
+}
+
+func (o *recordingObserver) CacheMiss(cluster string, key string) {
+	o.record("miss " + cluster + ":" + key)
+}
+
+func TestObserver(t *testing.T) {
+	state := NewState()
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"a1"}})
+	state.AddCluster("loop", Cluster{"CLUSTER": []string{"%loop"}})
+
+	observer := &recordingObserver{}
+	state.SetObserver(observer)
+
+	tests := []struct {
+		query  string
+		events []string
+	}{
+		{"%a", []string{"start %a", "miss a:CLUSTER", "end %a"}},
+		{"%a", []string{"start %a", "hit a:CLUSTER", "end %a"}},
+		{"%a:", []string{"start %a:", "end %a:", "parse error %a:"}},
+	}
+	for _, test := range tests {
+		state.Query(test.query)
+		if events := observer.take(); !reflect.DeepEqual(events, test.events) {
+			t.Errorf("Query(%s) events = %v, expected %v", test.query, events, test.events)
+		}
+	}
+
+	state.Query("%loop")
+	events := observer.take()
+	if len(events) < 2 || events[len(events)-2] != "recursion %loop" {
+		t.Errorf("Expected recursion limit for %%loop, got %v", events)
+	}
+
+	state.SetObserver(nil)
+	state.Query("%a")
+	if events := observer.take(); len(events) != 0 {
+		t.Errorf("Expected no events after removing observer, got %v", events)
+	}
+}
+
+func TestObserverTruncated(t *testing.T) {
+	state := NewState()
+	observer := &recordingObserver{}
+	state.SetObserver(observer)
+
+	query := "n1..20000"
+	if result, _ := state.Query(query); result.Cardinality() != MaxResults {
+		t.Errorf("Expected %d results, got %d", MaxResults, result.Cardinality())
+	}
+	expected := []string{"start " + query, "truncated " + query, "end " + query}
+	if events := observer.take(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Events = %v, expected %v", events, expected)
+	}
+}
+
+func TestExpvarObserver(t *testing.T) {
+	state := NewState()
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"a1..3"}})
+	state.AddCluster("b", Cluster{"CLUSTER": []string{"%a"}, "TYPE": []string{"x"}})
+
+	observer := NewExpvarObserver("grange_test_expvar_observer")
+	state.SetObserver(observer)
+
+	state.PrimeCache()
+	state.Query("%b")
+	state.Query("%b:")
+
+	expected := map[string]string{
+		"queries":      "2",
+		"query_errors": "1",
+		"results":      "3",
+		"parse_errors": "1",
+		"cache_hits":   "2",
+		"cache_misses": "3",
+		"prime_done":   "3",
+		"prime_total":  "3",
+	}
+	for name, value := range expected {
+		if v := observer.Map.Get(name); v == nil || v.String() != value {
+			t.Errorf("%s = %v, expected %s", name, v, value)
+		}
+	}
+	if expvar.Get("grange_test_expvar_observer") != observer.Map {
+		t.Errorf("Expected map to be published")
+	}
+}
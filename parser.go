@@ -1,5 +1,46 @@
 package grange
 
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// A ParseError is returned for queries that are not valid syntax. Offset is
+// roughly where parsing failed, in characters rather than bytes, so that it
+// can be used to point at the problem.
+type ParseError struct {
+	Query  string
+	Offset int
+}
+
+func (e *ParseError) Error() string {
+	return "Could not parse query: " + e.Query
+}
+
+// quote returns a "" constant that parses back to val.
+func quote(val string) string {
+	return strconv.Quote(val)
+}
+
+// unquote interprets the escapes in the contents of a "" constant.
+func unquote(val string) (string, error) {
+	buf := []byte{}
+	for len(val) > 0 {
+		c, multibyte, tail, err := strconv.UnquoteChar(val, '"')
+		if err != nil {
+			return "", err
+		}
+		val = tail
+
+		if c < utf8.RuneSelf || !multibyte {
+			buf = append(buf, byte(c))
+		} else {
+			buf = append(buf, string(c)...)
+		}
+	}
+	return string(buf), nil
+}
+
 func (r *rangeQuery) popNode() parserNode {
 	l := len(r.nodeStack)
 	result := r.nodeStack[l-1]
@@ -19,51 +60,50 @@ func (r *rangeQuery) addConstant(val string) {
 	r.pushNode(nodeConstant{val})
 }
 
+func (r *rangeQuery) addQuoted(val string, offset int) {
+	unquoted, err := unquote(val)
+	if err != nil && r.err == nil {
+		r.err = &ParseError{r.Buffer, offset}
+	}
+	r.addConstant(unquoted)
+}
+
 func (r *rangeQuery) addNull() {
 	r.pushNode(nodeNull{})
 }
 
-func (r *rangeQuery) addBraceStart() {
-	r.pushNode(nodeBraceStart{})
+// funcArgStart marks where a function argument begins on the node stack, so
+// that an argument that is itself a function call is not mistaken for the
+// function it is passed to.
+type funcArgStart struct{}
+
+func (n funcArgStart) String() string {
+	return ""
 }
 
-func (r *rangeQuery) addFuncArg() {
-	var funcNode parserNode
+func (r *rangeQuery) addFuncArgStart() {
+	r.pushNode(funcArgStart{})
+}
 
+// addFuncArg adds the node above the matching funcArgStart to the function
+// below it. Empty arguments are skipped.
+func (r *rangeQuery) addFuncArg() {
 	paramNode := r.popNode()
-	switch paramNode.(type) {
-	case nodeFunction:
-		// No arguments. This is kind of terrible, probably a better way to do
-		// this.
-		r.pushNode(paramNode)
-	default:
-		funcNode = r.nodeStack[len(r.nodeStack)-1]
-		fn := funcNode.(nodeFunction)
-		fn.params = append(fn.params, paramNode)
-		r.nodeStack[len(r.nodeStack)-1] = fn
+	if _, ok := paramNode.(funcArgStart); ok {
+		return
 	}
+	r.popNode()
+
+	fn := r.nodeStack[len(r.nodeStack)-1].(nodeFunction)
+	fn.params = append(fn.params, paramNode)
+	r.nodeStack[len(r.nodeStack)-1] = fn
 }
 
 func (r *rangeQuery) addBraces() {
 	right := r.popNode()
 	node := r.popNode()
+	left := r.popNode()
 
-	var left parserNode
-	left = nodeNull{}
-
-	// This is kind of bullshit but not sure a better way to do it yet
-	switch node.(type) {
-	case nodeBraceStart:
-		node = nodeNull{}
-	default:
-		if len(r.nodeStack) > 0 {
-			left = r.popNode()
-			switch left.(type) {
-			case nodeBraceStart:
-				left = nodeNull{}
-			}
-		}
-	}
 	r.pushNode(nodeBraces{node, left, right})
 }
 
@@ -77,6 +117,11 @@ func (r *rangeQuery) addGroupQuery() {
 	r.pushNode(nodeGroupQuery{exprNode})
 }
 
+func (r *rangeQuery) addComplement() {
+	exprNode := r.popNode()
+	r.pushNode(nodeComplement{exprNode})
+}
+
 func (r *rangeQuery) addClusterQuery() {
 	exprNode := r.popNode()
 	r.pushNode(nodeFunction{"clusters", []parserNode{exprNode}})
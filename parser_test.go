@@ -0,0 +1,252 @@
+package grange
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Conformance tests for operator precedence and associativity. See range.peg
+// for the precedence table.
+var precedenceTests = []struct {
+	query    string
+	expected Result
+}{
+	{"a , b & c", NewResult()},
+	{"a , b & b", NewResult("b")},
+	{"a , (b & c)", NewResult("a")},
+	{"(a , b) & b", NewResult("b")},
+	{"a & b , b", NewResult("b")},
+	{"a , b - a", NewResult("b")},
+	{"a - b , b", NewResult("a", "b")},
+	{"a - (b , a)", NewResult()},
+	{"a - b - a", NewResult()},
+	{"a , b ^ b , c", NewResult("a", "c")},
+	{"(a , b) ^ (b , c)", NewResult("a", "c")},
+	{"a ^ b & b", NewResult("b")},
+	{"a ^ (b & b)", NewResult("a", "b")},
+	{"x , a{b,c}", NewResult("xb", "xc", "ab", "ac")},
+	{"x , (a{b,c})", NewResult("x", "ab", "ac")},
+	{"a{b,c}d & abd", NewResult("abd")},
+	{"{a,b}{c,d}", NewResult("ac", "ad", "bc", "bd")},
+	{"a.{b,c}.d", NewResult("a.b.d", "a.c.d")},
+	{"(a,b){c}", NewResult("ac", "bc")},
+	{"a{}", NewResult("a")},
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	for _, test := range precedenceTests {
+		testEval(t, test.expected, test.query, emptyState())
+	}
+}
+
+var stringTests = []struct {
+	query    string
+	expected string
+}{
+	{"a,b&c", "a , b & c"},
+	{"(a,b)&c", "a , b & c"},
+	{"a,(b&c)", "a , (b & c)"},
+	{"a - b - c", "a - b - c"},
+	{"a - (b - c)", "a - (b - c)"},
+	{"a^b,c", "a ^ b , c"},
+	{"a^(b,c)", "a ^ (b , c)"},
+	{"(a&b)^c", "a & b ^ c"},
+	{"!(a,b)", "!(a , b)"},
+	{"!a,b", "!a , b"},
+	{"?(a,b)", "?(a , b)"},
+	{"{a,b}.c", "{a , b}.c"},
+	{"a.{b,c}.d", "a.{b , c}.d"},
+	{"x,a{b,c}", "(x , a){b , c}"},
+	{"x,(a{b,c})", "x , (a{b , c})"},
+	{"(a,b){c}", "(a , b){c}"},
+	{"%a:(B,C)", "%{a}:(B , C)"},
+	{"q(a b)", `"a b"`},
+	{`'a\"'`, `"a\\\""`},
+	{`"\u00e9\t"`, `"é\t"`},
+	{"count(allclusters())", "count(allclusters())"},
+	{"prefix(shortname(%a);x)", "prefix(shortname(%{a});x)"},
+	{"*allclusters()", "clusters(allclusters())"},
+	{"b,()", "b , ()"},
+	{"()", "()"},
+	{"a{}", "a{}"},
+	{"{a}{b}", "{a}{b}"},
+	{"!a{b}", "!a{b}"},
+	{"!(a{b})", "!(a{b})"},
+	{"x,!(a{b})", "x , !(a{b})"},
+	{"a{b}(c{d})", "a{b}(c{d})"},
+	{"%a:(B{C})", "%{a}:(B{C})"},
+	{"x,{a,b}c", "x , {a , b}c"},
+	{"x - f(a{b})", "x - f(a{b})"},
+	{"%{a}{b}", "%{{a}{b}}"},
+	{"%(x{a})", "%{x{a}}"},
+	{"%a{b}", "(%{a}){b}"},
+	{"(!{a}){b}", "(!{a}){b}"},
+	{"%a:B{c}", "%{a}:B{c}"},
+}
+
+func TestParseString(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a": Cluster{"CLUSTER": []string{"x"}, "B": []string{"y"}, "C": []string{"z"}},
+	})
+
+	for _, test := range stringTests {
+		node, err := parseRange(test.query, false)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+
+		actual := node.String()
+		if actual != test.expected {
+			t.Errorf("String()\n got: %s\nwant: %s", actual, test.expected)
+		}
+
+		// The string form must evaluate to the same result as the original.
+		want, _ := state.Query(test.query)
+		got, err := state.Query(actual)
+		if err != nil {
+			t.Errorf("%s: %s", actual, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("Round trip of %s\n got: %v\nwant: %v", test.query, got, want)
+		}
+	}
+}
+
+// Generates random queries from fragments, and checks that their string forms
+// parse back to the same string and evaluate to the same result.
+func TestParseStringRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	state := multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"x", "y"}, "B": []string{"y", "z"}, "T": []string{"y"}},
+		"b":      Cluster{"CLUSTER": []string{"%a:B", "w"}, "T": []string{"z"}},
+		"GROUPS": Cluster{"g": []string{"x", "b"}, "h": []string{"a"}},
+	})
+	atoms := []string{"a", "b", "x", "y1..2", "%a", "%a:B", "@g", "?x", "*x", "/x/", "q(a b)",
+		"()", "{a,b}", "has(T;y)", "allclusters()", "$B"}
+	ops := []string{",", "-", "&", "^"}
+
+	var build func(depth int) string
+	build = func(depth int) string {
+		if depth == 0 {
+			return atoms[r.Intn(len(atoms))]
+		}
+		switch r.Intn(8) {
+		case 0, 1:
+			return build(depth-1) + ops[r.Intn(len(ops))] + build(depth-1)
+		case 2:
+			return "(" + build(depth-1) + ")"
+		case 3:
+			return "!" + build(depth-1)
+		case 4:
+			return build(depth-1) + "{" + build(depth-1) + "}" + atoms[r.Intn(3)]
+		case 5:
+			return "count(" + build(depth-1) + ")"
+		case 6:
+			return "prefix(" + build(depth-1) + ";p)"
+		default:
+			return "%{" + build(depth-1) + "}:" + build(0)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		query := build(r.Intn(5))
+		node, err := parseRange(query, false)
+		if err != nil {
+			continue
+		}
+
+		str := node.String()
+		reparsed, err := parseRange(str, false)
+		if err != nil {
+			t.Errorf("%s: String() = %s, which does not parse: %s", query, str, err)
+			continue
+		}
+		if again := reparsed.String(); again != str {
+			t.Errorf("%s: String() = %s, which parses to %s", query, str, again)
+		}
+
+		want, wantErr := state.Query(query)
+		got, gotErr := state.Query(str)
+		if (wantErr == nil) != (gotErr == nil) || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: String() = %s\n got: %v %v\nwant: %v %v", query, str, got, gotErr, want, wantErr)
+		}
+	}
+}
+
+func TestParseNestedFunctions(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected parserNode
+	}{
+		{"f()", nodeFunction{"f", []parserNode{}}},
+		{"f(g())", nodeFunction{"f", []parserNode{nodeFunction{"g", []parserNode{}}}}},
+		{"f(g(a);h(b;c))", nodeFunction{"f", []parserNode{
+			nodeFunction{"g", []parserNode{nodeText{"a"}}},
+			nodeFunction{"h", []parserNode{nodeText{"b"}, nodeText{"c"}}},
+		}}},
+		{"f(a;g(h()))", nodeFunction{"f", []parserNode{
+			nodeText{"a"},
+			nodeFunction{"g", []parserNode{nodeFunction{"h", []parserNode{}}}},
+		}}},
+	}
+
+	for _, test := range tests {
+		node, err := parseRange(test.query, false)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+		} else if !reflect.DeepEqual(node, test.expected) {
+			t.Errorf("parseRange(%s)\n got: %#v\nwant: %#v", test.query, node, test.expected)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	state := emptyState()
+	actual, err := state.Explain("%a:B & web1..3,!f(/x/;q(y))")
+	expected := `%{a}:B & web1..3 , !f(/x/;"y")
+union (,)
+  intersection (&)
+    cluster lookup
+      cluster: value a
+      key: value B
+    numeric range web1..3
+  complement
+    function f
+      param 1: regex /x/
+      param 2: constant "y"`
+
+	if err != nil {
+		t.Errorf("Explain returned error: %s", err)
+	} else if actual != expected {
+		t.Errorf("Explain\n got: %s\nwant: %s", actual, expected)
+	}
+
+	_, err = state.Explain("a,")
+	if err == nil || err.Error() != "Could not parse query: a," {
+		t.Errorf("Expected parse error, got: %v", err)
+	}
+}
+
+func TestParseErrorOffset(t *testing.T) {
+	tests := []struct {
+		query  string
+		offset int
+	}{
+		{"a,", 1},
+		{"a & & b", 4},
+		{"f(a;", 4},
+		{"a,b)", 3},
+		{`x,"ab\q"`, 5},
+		{"é & & b", 4},
+	}
+
+	for _, test := range tests {
+		_, err := parseRange(test.query, true)
+		if e, ok := err.(*ParseError); !ok {
+			t.Errorf("%s: expected ParseError, got %v", test.query, err)
+		} else if e.Offset != test.offset || e.Query != test.query {
+			t.Errorf("%s: got offset %d, want %d", test.query, e.Offset, test.offset)
+		}
+	}
+}
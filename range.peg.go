@@ -5,9 +5,10 @@ import (
 	"math"
 	"sort"
 	"strconv"
+	"unicode"
 )
 
-const end_symbol rune = 1114112
+const endSymbol rune = 1114112
 
 /* The rule types inferred from the grammar are below. */
 type pegRule uint8
@@ -17,16 +18,17 @@ const (
 	ruleexpression
 	rulecombinedexpr
 	rulerangeexpr
-	rulecombinators
-	ruleintersect
-	ruleexclude
 	ruleunion
+	ruleexclude
+	ruleintersect
+	rulesymdiff
 	rulebraces
 	rulebrackets
 	ruleclusterq
 	rulegroupq
 	rulecluster
 	rulegroup
+	rulecomplement
 	rulekey
 	rulelocalkey
 	rulefunction
@@ -34,11 +36,17 @@ const (
 	ruleregex
 	ruleliteral
 	rulevalue
+	rulevalueChar
+	rulestep
 	ruleleaderChar
+	ruleletter
 	rulespace
 	ruleconst
 	ruleq
 	rulequoted
+	ruleraw
+	ruleescape
+	rulehex
 	ruleAction0
 	ruleAction1
 	ruleAction2
@@ -54,15 +62,23 @@ const (
 	ruleAction12
 	ruleAction13
 	ruleAction14
-	rulePegText
 	ruleAction15
 	ruleAction16
 	ruleAction17
 	ruleAction18
-
-	rulePre_
-	rule_In_
-	rule_Suf
+	ruleAction19
+	ruleAction20
+	ruleAction21
+	rulePegText
+	ruleAction22
+	ruleAction23
+	ruleAction24
+	ruleAction25
+	ruleAction26
+
+	rulePre
+	ruleIn
+	ruleSuf
 )
 
 var rul3s = [...]string{
@@ -70,16 +86,17 @@ var rul3s = [...]string{
 	"expression",
 	"combinedexpr",
 	"rangeexpr",
-	"combinators",
-	"intersect",
-	"exclude",
 	"union",
+	"exclude",
+	"intersect",
+	"symdiff",
 	"braces",
 	"brackets",
 	"clusterq",
 	"groupq",
 	"cluster",
 	"group",
+	"complement",
 	"key",
 	"localkey",
 	"function",
@@ -87,11 +104,17 @@ var rul3s = [...]string{
 	"regex",
 	"literal",
 	"value",
+	"valueChar",
+	"step",
 	"leaderChar",
+	"letter",
 	"space",
 	"const",
 	"q",
 	"quoted",
+	"raw",
+	"escape",
+	"hex",
 	"Action0",
 	"Action1",
 	"Action2",
@@ -107,29 +130,25 @@ var rul3s = [...]string{
 	"Action12",
 	"Action13",
 	"Action14",
-	"PegText",
 	"Action15",
 	"Action16",
 	"Action17",
 	"Action18",
+	"Action19",
+	"Action20",
+	"Action21",
+	"PegText",
+	"Action22",
+	"Action23",
+	"Action24",
+	"Action25",
+	"Action26",
 
 	"Pre_",
 	"_In_",
 	"_Suf",
 }
 
-type tokenTree interface {
-	Print()
-	PrintSyntax()
-	PrintSyntaxTree(buffer string)
-	Add(rule pegRule, begin, end, next uint32, depth int)
-	Expand(index int) tokenTree
-	Tokens() <-chan token32
-	AST() *node32
-	Error() []token32
-	trim(length int)
-}
-
 type node32 struct {
 	token32
 	up, next *node32
@@ -148,8 +167,8 @@ func (node *node32) print(depth int, buffer string) {
 	}
 }
 
-func (ast *node32) Print(buffer string) {
-	ast.print(0, buffer)
+func (node *node32) Print(buffer string) {
+	node.print(0, buffer)
 }
 
 type element struct {
@@ -257,7 +276,7 @@ func (t *tokens32) PreOrder() (<-chan state32, [][]token32) {
 	s, ordered := make(chan state32, 6), t.Order()
 	go func() {
 		var states [8]state32
-		for i, _ := range states {
+		for i := range states {
 			states[i].depths = make([]int32, len(ordered))
 		}
 		depths, state, depth := make([]int32, len(ordered)), 0, 1
@@ -279,14 +298,14 @@ func (t *tokens32) PreOrder() (<-chan state32, [][]token32) {
 					if c, j := ordered[depth][i-1], depths[depth-1]; a.isParentOf(c) &&
 						(j < 2 || !ordered[depth-1][j-2].isParentOf(c)) {
 						if c.end != b.begin {
-							write(token32{pegRule: rule_In_, begin: c.end, end: b.begin}, true)
+							write(token32{pegRule: ruleIn, begin: c.end, end: b.begin}, true)
 						}
 						break
 					}
 				}
 
 				if a.begin < b.begin {
-					write(token32{pegRule: rulePre_, begin: a.begin, end: b.begin}, true)
+					write(token32{pegRule: rulePre, begin: a.begin, end: b.begin}, true)
 				}
 				break
 			}
@@ -307,7 +326,7 @@ func (t *tokens32) PreOrder() (<-chan state32, [][]token32) {
 					b = c
 					continue depthFirstSearch
 				} else if parent && b.end != a.end {
-					write(token32{pegRule: rule_Suf, begin: b.end, end: a.end}, true)
+					write(token32{pegRule: ruleSuf, begin: b.end, end: a.end}, true)
 				}
 
 				depth--
@@ -396,7 +415,7 @@ func (t *tokens32) Error() []token32 {
 	ordered := t.Order()
 	length := len(ordered)
 	tokens, length := make([]token32, length), length-1
-	for i, _ := range tokens {
+	for i := range tokens {
 		o := ordered[length-i]
 		if len(o) > 1 {
 			tokens[i] = o[len(o)-2].getToken32()
@@ -405,38 +424,28 @@ func (t *tokens32) Error() []token32 {
 	return tokens
 }
 
-/*func (t *tokens16) Expand(index int) tokenTree {
-	tree := t.tree
-	if index >= len(tree) {
-		expanded := make([]token32, 2 * len(tree))
-		for i, v := range tree {
-			expanded[i] = v.getToken32()
-		}
-		return &tokens32{tree: expanded}
-	}
-	return nil
-}*/
-
-func (t *tokens32) Expand(index int) tokenTree {
+func (t *tokens32) Expand(index int) {
 	tree := t.tree
 	if index >= len(tree) {
 		expanded := make([]token32, 2*len(tree))
 		copy(expanded, tree)
 		t.tree = expanded
 	}
-	return nil
 }
 
 type rangeQuery struct {
 	currentLiteral string
 	nodeStack      []parserNode
+	err            error
+	unicode        bool
 
 	Buffer string
 	buffer []rune
-	rules  [46]func() bool
+	rules  [61]func() bool
 	Parse  func(rule ...int) error
 	Reset  func()
-	tokenTree
+	Pretty bool
+	tokens32
 }
 
 type textPosition struct {
@@ -445,12 +454,12 @@ type textPosition struct {
 
 type textPositionMap map[int]textPosition
 
-func translatePositions(buffer string, positions []int) textPositionMap {
+func translatePositions(buffer []rune, positions []int) textPositionMap {
 	length, translations, j, line, symbol := len(positions), make(textPositionMap, len(positions)), 0, 1, 0
 	sort.Ints(positions)
 
 search:
-	for i, c := range buffer[0:] {
+	for i, c := range buffer {
 		if c == '\n' {
 			line, symbol = line+1, 0
 		} else {
@@ -471,40 +480,45 @@ search:
 }
 
 type parseError struct {
-	p *rangeQuery
+	p   *rangeQuery
+	max token32
 }
 
 func (e *parseError) Error() string {
-	tokens, error := e.p.tokenTree.Error(), "\n"
+	tokens, error := []token32{e.max}, "\n"
 	positions, p := make([]int, 2*len(tokens)), 0
 	for _, token := range tokens {
 		positions[p], p = int(token.begin), p+1
 		positions[p], p = int(token.end), p+1
 	}
-	translations := translatePositions(e.p.Buffer, positions)
+	translations := translatePositions(e.p.buffer, positions)
+	format := "parse error near %v (line %v symbol %v - line %v symbol %v):\n%v\n"
+	if e.p.Pretty {
+		format = "parse error near \x1B[34m%v\x1B[m (line %v symbol %v - line %v symbol %v):\n%v\n"
+	}
 	for _, token := range tokens {
 		begin, end := int(token.begin), int(token.end)
-		error += fmt.Sprintf("parse error near \x1B[34m%v\x1B[m (line %v symbol %v - line %v symbol %v):\n%v\n",
+		error += fmt.Sprintf(format,
 			rul3s[token.pegRule],
 			translations[begin].line, translations[begin].symbol,
 			translations[end].line, translations[end].symbol,
-			/*strconv.Quote(*/ e.p.Buffer[begin:end] /*)*/)
+			strconv.Quote(string(e.p.buffer[begin:end])))
 	}
 
 	return error
 }
 
 func (p *rangeQuery) PrintSyntaxTree() {
-	p.tokenTree.PrintSyntaxTree(p.Buffer)
+	p.tokens32.PrintSyntaxTree(p.Buffer)
 }
 
 func (p *rangeQuery) Highlighter() {
-	p.tokenTree.PrintSyntax()
+	p.PrintSyntax()
 }
 
 func (p *rangeQuery) Execute() {
 	buffer, _buffer, text, begin, end := p.Buffer, p.buffer, "", 0, 0
-	for token := range p.tokenTree.Tokens() {
+	for token := range p.Tokens() {
 		switch token.pegRule {
 
 		case rulePegText:
@@ -512,57 +526,74 @@ func (p *rangeQuery) Execute() {
 			text = string(_buffer[begin:end])
 
 		case ruleAction0:
-			p.addBraceStart()
+			p.addNull()
 		case ruleAction1:
-			p.addOperator(operatorIntersect)
+			p.addOperator(operatorUnion)
 		case ruleAction2:
 			p.addOperator(operatorSubtract)
 		case ruleAction3:
-			p.addOperator(operatorUnion)
+			p.addOperator(operatorIntersect)
 		case ruleAction4:
-			p.addBraces()
+			p.addOperator(operatorSymmetricDifference)
 		case ruleAction5:
-			p.addClusterQuery()
+			p.addNull()
 		case ruleAction6:
-			p.addGroupQuery()
+			p.addNull()
 		case ruleAction7:
-			p.addValue(buffer[begin:end])
-			p.addClusterLookup()
+			p.addBraces()
 		case ruleAction8:
-			p.addClusterLookup()
+			p.addNull()
 		case ruleAction9:
-			p.addGroupLookup()
+			p.addClusterQuery()
 		case ruleAction10:
-			p.addKeyLookup()
+			p.addGroupQuery()
 		case ruleAction11:
-			p.addLocalClusterLookup(buffer[begin:end])
+			p.addValue(text)
+			p.addClusterLookup()
 		case ruleAction12:
-			p.addFunction(buffer[begin:end])
+			p.addClusterLookup()
 		case ruleAction13:
-			p.addFuncArg()
+			p.addGroupLookup()
 		case ruleAction14:
-			p.addFuncArg()
+			p.addComplement()
 		case ruleAction15:
-			p.addRegex(buffer[begin:end])
+			p.addKeyLookup()
 		case ruleAction16:
-			p.addValue(buffer[begin:end])
+			p.addLocalClusterLookup(text)
 		case ruleAction17:
-			p.addConstant(buffer[begin:end])
+			p.addFunction(text)
 		case ruleAction18:
-			p.addConstant(buffer[begin:end])
+			p.addFuncArgStart()
+		case ruleAction19:
+			p.addFuncArg()
+		case ruleAction20:
+			p.addFuncArgStart()
+		case ruleAction21:
+			p.addFuncArg()
+		case ruleAction22:
+			p.addRegex(text)
+		case ruleAction23:
+			p.addValue(text)
+		case ruleAction24:
+			p.addConstant(text)
+		case ruleAction25:
+			p.addQuoted(text, begin)
+		case ruleAction26:
+			p.addConstant(text)
 
 		}
 	}
-	_, _, _, _ = buffer, text, begin, end
+	_, _, _, _, _ = buffer, _buffer, text, begin, end
 }
 
 func (p *rangeQuery) Init() {
 	p.buffer = []rune(p.Buffer)
-	if len(p.buffer) == 0 || p.buffer[len(p.buffer)-1] != end_symbol {
-		p.buffer = append(p.buffer, end_symbol)
+	if len(p.buffer) == 0 || p.buffer[len(p.buffer)-1] != endSymbol {
+		p.buffer = append(p.buffer, endSymbol)
 	}
 
-	var tree tokenTree = &tokens32{tree: make([]token32, math.MaxInt16)}
+	tree := tokens32{tree: make([]token32, math.MaxInt16)}
+	var max token32
 	position, depth, tokenIndex, buffer, _rules := uint32(0), uint32(0), 0, p.buffer, p.rules
 
 	p.Parse = func(rule ...int) error {
@@ -571,12 +602,12 @@ func (p *rangeQuery) Init() {
 			r = rule[0]
 		}
 		matches := p.rules[r]()
-		p.tokenTree = tree
+		p.tokens32 = tree
 		if matches {
-			p.tokenTree.trim(tokenIndex)
+			p.trim(tokenIndex)
 			return nil
 		}
-		return &parseError{p}
+		return &parseError{p, max}
 	}
 
 	p.Reset = func() {
@@ -584,15 +615,16 @@ func (p *rangeQuery) Init() {
 	}
 
 	add := func(rule pegRule, begin uint32) {
-		if t := tree.Expand(tokenIndex); t != nil {
-			tree = t
-		}
+		tree.Expand(tokenIndex)
 		tree.Add(rule, begin, position, depth, tokenIndex)
 		tokenIndex++
+		if begin != position && position > max.end {
+			max = token32{rule, begin, position, depth}
+		}
 	}
 
 	matchDot := func() bool {
-		if buffer[position] != end_symbol {
+		if buffer[position] != endSymbol {
 			position++
 			return true
 		}
@@ -650,7 +682,7 @@ func (p *rangeQuery) Init() {
 			position, tokenIndex, depth = position0, tokenIndex0, depth0
 			return false
 		},
-		/* 1 combinedexpr <- <(rangeexpr combinators?)> */
+		/* 1 combinedexpr <- <(rangeexpr (union / exclude / intersect / symdiff / braces)*)> */
 		func() bool {
 			position5, tokenIndex5, depth5 := position, tokenIndex, depth
 			{
@@ -659,16 +691,44 @@ func (p *rangeQuery) Init() {
 				if !_rules[rulerangeexpr]() {
 					goto l5
 				}
+			l7:
 				{
-					position7, tokenIndex7, depth7 := position, tokenIndex, depth
-					if !_rules[rulecombinators]() {
-						goto l7
+					position8, tokenIndex8, depth8 := position, tokenIndex, depth
+					{
+						position9, tokenIndex9, depth9 := position, tokenIndex, depth
+						if !_rules[ruleunion]() {
+							goto l10
+						}
+						goto l9
+					l10:
+						position, tokenIndex, depth = position9, tokenIndex9, depth9
+						if !_rules[ruleexclude]() {
+							goto l11
+						}
+						goto l9
+					l11:
+						position, tokenIndex, depth = position9, tokenIndex9, depth9
+						if !_rules[ruleintersect]() {
+							goto l12
+						}
+						goto l9
+					l12:
+						position, tokenIndex, depth = position9, tokenIndex9, depth9
+						if !_rules[rulesymdiff]() {
+							goto l13
+						}
+						goto l9
+					l13:
+						position, tokenIndex, depth = position9, tokenIndex9, depth9
+						if !_rules[rulebraces]() {
+							goto l8
+						}
 					}
-					goto l8
-				l7:
-					position, tokenIndex, depth = position7, tokenIndex7, depth7
+				l9:
+					goto l7
+				l8:
+					position, tokenIndex, depth = position8, tokenIndex8, depth8
 				}
-			l8:
 				depth--
 				add(rulecombinedexpr, position6)
 			}
@@ -677,919 +737,1611 @@ func (p *rangeQuery) Init() {
 			position, tokenIndex, depth = position5, tokenIndex5, depth5
 			return false
 		},
-		/* 2 rangeexpr <- <(space (const / function / ((&('{') (Action0 braces)) | (&('(') brackets) | (&('/') regex) | (&('$') localkey) | (&('?') groupq) | (&('@') group) | (&('*') clusterq) | (&('%') cluster) | (&('.' | '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9' | 'A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'G' | 'H' | 'I' | 'J' | 'K' | 'L' | 'M' | 'N' | 'O' | 'P' | 'Q' | 'R' | 'S' | 'T' | 'U' | 'V' | 'W' | 'X' | 'Y' | 'Z' | '_' | 'a' | 'b' | 'c' | 'd' | 'e' | 'f' | 'g' | 'h' | 'i' | 'j' | 'k' | 'l' | 'm' | 'n' | 'o' | 'p' | 'q' | 'r' | 's' | 't' | 'u' | 'v' | 'w' | 'x' | 'y' | 'z') value))) space)> */
+		/* 2 rangeexpr <- <(space (const / function / cluster / clusterq / group / groupq / localkey / regex / value / complement / brackets / (Action0 braces)) space)> */
 		func() bool {
-			position9, tokenIndex9, depth9 := position, tokenIndex, depth
+			position14, tokenIndex14, depth14 := position, tokenIndex, depth
 			{
-				position10 := position
+				position15 := position
 				depth++
 				if !_rules[rulespace]() {
-					goto l9
+					goto l14
 				}
 				{
-					position11, tokenIndex11, depth11 := position, tokenIndex, depth
-					{
-						position13 := position
-						depth++
-						{
-							position14, tokenIndex14, depth14 := position, tokenIndex, depth
-							{
-								position16 := position
-								depth++
-								if buffer[position] != rune('q') {
-									goto l15
-								}
-								position++
-								if buffer[position] != rune('(') {
-									goto l15
-								}
-								position++
-								{
-									position17 := position
-									depth++
-								l18:
-									{
-										position19, tokenIndex19, depth19 := position, tokenIndex, depth
-										{
-											position20, tokenIndex20, depth20 := position, tokenIndex, depth
-											if buffer[position] != rune(')') {
-												goto l20
-											}
-											position++
-											goto l19
-										l20:
-											position, tokenIndex, depth = position20, tokenIndex20, depth20
-										}
-										if !matchDot() {
-											goto l19
-										}
-										goto l18
-									l19:
-										position, tokenIndex, depth = position19, tokenIndex19, depth19
-									}
-									depth--
-									add(rulePegText, position17)
-								}
-								if buffer[position] != rune(')') {
-									goto l15
-								}
-								position++
-								{
-									add(ruleAction17, position)
-								}
-								depth--
-								add(ruleq, position16)
-							}
-							goto l14
-						l15:
-							position, tokenIndex, depth = position14, tokenIndex14, depth14
-							{
-								position22 := position
-								depth++
-								if buffer[position] != rune('"') {
-									goto l12
-								}
-								position++
-								{
-									position23 := position
-									depth++
-								l24:
-									{
-										position25, tokenIndex25, depth25 := position, tokenIndex, depth
-										{
-											position26, tokenIndex26, depth26 := position, tokenIndex, depth
-											if buffer[position] != rune('"') {
-												goto l26
-											}
-											position++
-											goto l25
-										l26:
-											position, tokenIndex, depth = position26, tokenIndex26, depth26
-										}
-										if !matchDot() {
-											goto l25
-										}
-										goto l24
-									l25:
-										position, tokenIndex, depth = position25, tokenIndex25, depth25
-									}
-									depth--
-									add(rulePegText, position23)
-								}
-								if buffer[position] != rune('"') {
-									goto l12
-								}
-								position++
-								{
-									add(ruleAction18, position)
-								}
-								depth--
-								add(rulequoted, position22)
-							}
-						}
-					l14:
-						depth--
-						add(ruleconst, position13)
+					position16, tokenIndex16, depth16 := position, tokenIndex, depth
+					if !_rules[ruleconst]() {
+						goto l17
 					}
-					goto l11
-				l12:
-					position, tokenIndex, depth = position11, tokenIndex11, depth11
-					{
-						position29 := position
-						depth++
-						if !_rules[ruleliteral]() {
-							goto l28
-						}
-						{
-							add(ruleAction12, position)
-						}
-						if buffer[position] != rune('(') {
-							goto l28
-						}
-						position++
-						if !_rules[rulefuncargs]() {
-							goto l28
-						}
-						if buffer[position] != rune(')') {
-							goto l28
-						}
-						position++
-						depth--
-						add(rulefunction, position29)
+					goto l16
+				l17:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulefunction]() {
+						goto l18
 					}
-					goto l11
-				l28:
-					position, tokenIndex, depth = position11, tokenIndex11, depth11
-					{
-						switch buffer[position] {
-						case '{':
-							{
-								add(ruleAction0, position)
-							}
-							if !_rules[rulebraces]() {
-								goto l9
-							}
-							break
-						case '(':
-							{
-								position33 := position
-								depth++
-								if buffer[position] != rune('(') {
-									goto l9
-								}
-								position++
-								{
-									position34, tokenIndex34, depth34 := position, tokenIndex, depth
-									if !_rules[rulecombinedexpr]() {
-										goto l34
-									}
-									goto l35
-								l34:
-									position, tokenIndex, depth = position34, tokenIndex34, depth34
-								}
-							l35:
-								if buffer[position] != rune(')') {
-									goto l9
-								}
-								position++
-								depth--
-								add(rulebrackets, position33)
-							}
-							break
-						case '/':
-							{
-								position36 := position
-								depth++
-								if buffer[position] != rune('/') {
-									goto l9
-								}
-								position++
-								{
-									position37 := position
-									depth++
-								l38:
-									{
-										position39, tokenIndex39, depth39 := position, tokenIndex, depth
-										{
-											position40, tokenIndex40, depth40 := position, tokenIndex, depth
-											if buffer[position] != rune('/') {
-												goto l40
-											}
-											position++
-											goto l39
-										l40:
-											position, tokenIndex, depth = position40, tokenIndex40, depth40
-										}
-										if !matchDot() {
-											goto l39
-										}
-										goto l38
-									l39:
-										position, tokenIndex, depth = position39, tokenIndex39, depth39
-									}
-									depth--
-									add(rulePegText, position37)
-								}
-								if buffer[position] != rune('/') {
-									goto l9
-								}
-								position++
-								{
-									add(ruleAction15, position)
-								}
-								depth--
-								add(ruleregex, position36)
-							}
-							break
-						case '$':
-							{
-								position42 := position
-								depth++
-								if buffer[position] != rune('$') {
-									goto l9
-								}
-								position++
-								if !_rules[ruleliteral]() {
-									goto l9
-								}
-								{
-									add(ruleAction11, position)
-								}
-								depth--
-								add(rulelocalkey, position42)
-							}
-							break
-						case '?':
-							{
-								position44 := position
-								depth++
-								if buffer[position] != rune('?') {
-									goto l9
-								}
-								position++
-								if !_rules[rulerangeexpr]() {
-									goto l9
-								}
-								{
-									add(ruleAction6, position)
-								}
-								depth--
-								add(rulegroupq, position44)
-							}
-							break
-						case '@':
-							{
-								position46 := position
-								depth++
-								if buffer[position] != rune('@') {
-									goto l9
-								}
-								position++
-								if !_rules[rulerangeexpr]() {
-									goto l9
-								}
-								{
-									add(ruleAction9, position)
-								}
-								depth--
-								add(rulegroup, position46)
-							}
-							break
-						case '*':
-							{
-								position48 := position
-								depth++
-								if buffer[position] != rune('*') {
-									goto l9
-								}
-								position++
-								if !_rules[rulerangeexpr]() {
-									goto l9
-								}
-								{
-									add(ruleAction5, position)
-								}
-								depth--
-								add(ruleclusterq, position48)
-							}
-							break
-						case '%':
-							{
-								position50 := position
-								depth++
-								{
-									position51, tokenIndex51, depth51 := position, tokenIndex, depth
-									if buffer[position] != rune('%') {
-										goto l52
-									}
-									position++
-									if !_rules[ruleliteral]() {
-										goto l52
-									}
-									{
-										add(ruleAction7, position)
-									}
-									{
-										position54, tokenIndex54, depth54 := position, tokenIndex, depth
-										if !_rules[rulekey]() {
-											goto l54
-										}
-										goto l55
-									l54:
-										position, tokenIndex, depth = position54, tokenIndex54, depth54
-									}
-								l55:
-									goto l51
-								l52:
-									position, tokenIndex, depth = position51, tokenIndex51, depth51
-									if buffer[position] != rune('%') {
-										goto l9
-									}
-									position++
-									if !_rules[rulerangeexpr]() {
-										goto l9
-									}
-									{
-										add(ruleAction8, position)
-									}
-									{
-										position57, tokenIndex57, depth57 := position, tokenIndex, depth
-										if !_rules[rulekey]() {
-											goto l57
-										}
-										goto l58
-									l57:
-										position, tokenIndex, depth = position57, tokenIndex57, depth57
-									}
-								l58:
-								}
-							l51:
-								depth--
-								add(rulecluster, position50)
-							}
-							break
-						default:
-							{
-								position59 := position
-								depth++
-								{
-									position60 := position
-									depth++
-									if !_rules[ruleleaderChar]() {
-										goto l9
-									}
-								l61:
-									{
-										position62, tokenIndex62, depth62 := position, tokenIndex, depth
-										{
-											switch buffer[position] {
-											case '.':
-												if buffer[position] != rune('.') {
-													goto l62
-												}
-												position++
-												break
-											case '_':
-												if buffer[position] != rune('_') {
-													goto l62
-												}
-												position++
-												break
-											case '-':
-												if buffer[position] != rune('-') {
-													goto l62
-												}
-												position++
-												break
-											case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-												{
-													position64, tokenIndex64, depth64 := position, tokenIndex, depth
-													if c := buffer[position]; c < rune('0') || c > rune('9') {
-														goto l65
-													}
-													position++
-													goto l64
-												l65:
-													position, tokenIndex, depth = position64, tokenIndex64, depth64
-													if c := buffer[position]; c < rune('0') || c > rune('9') {
-														goto l62
-													}
-													position++
-												}
-											l64:
-												break
-											case ':':
-												if buffer[position] != rune(':') {
-													goto l62
-												}
-												position++
-												break
-											default:
-												{
-													position66, tokenIndex66, depth66 := position, tokenIndex, depth
-													if c := buffer[position]; c < rune('a') || c > rune('z') {
-														goto l67
-													}
-													position++
-													goto l66
-												l67:
-													position, tokenIndex, depth = position66, tokenIndex66, depth66
-													if c := buffer[position]; c < rune('A') || c > rune('Z') {
-														goto l62
-													}
-													position++
-												}
-											l66:
-												break
-											}
-										}
-
-										goto l61
-									l62:
-										position, tokenIndex, depth = position62, tokenIndex62, depth62
-									}
-									depth--
-									add(rulePegText, position60)
-								}
-								{
-									add(ruleAction16, position)
-								}
-								depth--
-								add(rulevalue, position59)
-							}
-							break
-						}
+					goto l16
+				l18:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulecluster]() {
+						goto l19
+					}
+					goto l16
+				l19:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[ruleclusterq]() {
+						goto l20
+					}
+					goto l16
+				l20:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulegroup]() {
+						goto l21
+					}
+					goto l16
+				l21:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulegroupq]() {
+						goto l22
+					}
+					goto l16
+				l22:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulelocalkey]() {
+						goto l23
+					}
+					goto l16
+				l23:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[ruleregex]() {
+						goto l24
+					}
+					goto l16
+				l24:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulevalue]() {
+						goto l25
+					}
+					goto l16
+				l25:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulecomplement]() {
+						goto l26
+					}
+					goto l16
+				l26:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[rulebrackets]() {
+						goto l27
+					}
+					goto l16
+				l27:
+					position, tokenIndex, depth = position16, tokenIndex16, depth16
+					if !_rules[ruleAction0]() {
+						goto l14
+					}
+					if !_rules[rulebraces]() {
+						goto l14
 					}
-
 				}
-			l11:
+			l16:
 				if !_rules[rulespace]() {
-					goto l9
+					goto l14
 				}
 				depth--
-				add(rulerangeexpr, position10)
+				add(rulerangeexpr, position15)
 			}
 			return true
-		l9:
-			position, tokenIndex, depth = position9, tokenIndex9, depth9
+		l14:
+			position, tokenIndex, depth = position14, tokenIndex14, depth14
 			return false
 		},
-		/* 3 combinators <- <(space ((&('{') braces) | (&('-') exclude) | (&('&') intersect) | (&(',') union)))> */
+		/* 3 union <- <(space ',' rangeexpr Action1)> */
 		func() bool {
-			position69, tokenIndex69, depth69 := position, tokenIndex, depth
+			position28, tokenIndex28, depth28 := position, tokenIndex, depth
 			{
-				position70 := position
+				position29 := position
 				depth++
 				if !_rules[rulespace]() {
-					goto l69
+					goto l28
 				}
-				{
-					switch buffer[position] {
-					case '{':
-						if !_rules[rulebraces]() {
-							goto l69
-						}
-						break
-					case '-':
-						{
-							position72 := position
-							depth++
-							if buffer[position] != rune('-') {
-								goto l69
-							}
-							position++
-							if !_rules[rulerangeexpr]() {
-								goto l69
-							}
-							{
-								add(ruleAction2, position)
-							}
-							{
-								position74, tokenIndex74, depth74 := position, tokenIndex, depth
-								if !_rules[rulecombinators]() {
-									goto l74
-								}
-								goto l75
-							l74:
-								position, tokenIndex, depth = position74, tokenIndex74, depth74
-							}
-						l75:
-							depth--
-							add(ruleexclude, position72)
-						}
-						break
-					case '&':
-						{
-							position76 := position
-							depth++
-							if buffer[position] != rune('&') {
-								goto l69
-							}
-							position++
-							if !_rules[rulerangeexpr]() {
-								goto l69
-							}
-							{
-								add(ruleAction1, position)
-							}
-							{
-								position78, tokenIndex78, depth78 := position, tokenIndex, depth
-								if !_rules[rulecombinators]() {
-									goto l78
-								}
-								goto l79
-							l78:
-								position, tokenIndex, depth = position78, tokenIndex78, depth78
-							}
-						l79:
-							depth--
-							add(ruleintersect, position76)
-						}
-						break
-					default:
-						{
-							position80 := position
-							depth++
-							if buffer[position] != rune(',') {
-								goto l69
-							}
-							position++
-							if !_rules[rulerangeexpr]() {
-								goto l69
-							}
-							{
-								add(ruleAction3, position)
-							}
-							{
-								position82, tokenIndex82, depth82 := position, tokenIndex, depth
-								if !_rules[rulecombinators]() {
-									goto l82
-								}
-								goto l83
-							l82:
-								position, tokenIndex, depth = position82, tokenIndex82, depth82
-							}
-						l83:
-							depth--
-							add(ruleunion, position80)
-						}
-						break
-					}
+				if buffer[position] != rune(',') {
+					goto l28
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l28
+				}
+				if !_rules[ruleAction1]() {
+					goto l28
 				}
-
 				depth--
-				add(rulecombinators, position70)
+				add(ruleunion, position29)
 			}
 			return true
-		l69:
-			position, tokenIndex, depth = position69, tokenIndex69, depth69
+		l28:
+			position, tokenIndex, depth = position28, tokenIndex28, depth28
 			return false
 		},
-		/* 4 intersect <- <('&' rangeexpr Action1 combinators?)> */
-		nil,
-		/* 5 exclude <- <('-' rangeexpr Action2 combinators?)> */
-		nil,
-		/* 6 union <- <(',' rangeexpr Action3 combinators?)> */
-		nil,
-		/* 7 braces <- <('{' combinedexpr? '}' rangeexpr? Action4)> */
+		/* 4 exclude <- <(space '-' rangeexpr Action2)> */
+		func() bool {
+			position30, tokenIndex30, depth30 := position, tokenIndex, depth
+			{
+				position31 := position
+				depth++
+				if !_rules[rulespace]() {
+					goto l30
+				}
+				if buffer[position] != rune('-') {
+					goto l30
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l30
+				}
+				if !_rules[ruleAction2]() {
+					goto l30
+				}
+				depth--
+				add(ruleexclude, position31)
+			}
+			return true
+		l30:
+			position, tokenIndex, depth = position30, tokenIndex30, depth30
+			return false
+		},
+		/* 5 intersect <- <(space '&' rangeexpr Action3)> */
+		func() bool {
+			position32, tokenIndex32, depth32 := position, tokenIndex, depth
+			{
+				position33 := position
+				depth++
+				if !_rules[rulespace]() {
+					goto l32
+				}
+				if buffer[position] != rune('&') {
+					goto l32
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l32
+				}
+				if !_rules[ruleAction3]() {
+					goto l32
+				}
+				depth--
+				add(ruleintersect, position33)
+			}
+			return true
+		l32:
+			position, tokenIndex, depth = position32, tokenIndex32, depth32
+			return false
+		},
+		/* 6 symdiff <- <(space '^' rangeexpr Action4)> */
+		func() bool {
+			position34, tokenIndex34, depth34 := position, tokenIndex, depth
+			{
+				position35 := position
+				depth++
+				if !_rules[rulespace]() {
+					goto l34
+				}
+				if buffer[position] != rune('^') {
+					goto l34
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l34
+				}
+				if !_rules[ruleAction4]() {
+					goto l34
+				}
+				depth--
+				add(rulesymdiff, position35)
+			}
+			return true
+		l34:
+			position, tokenIndex, depth = position34, tokenIndex34, depth34
+			return false
+		},
+		/* 7 braces <- <('{' (combinedexpr / Action5) '}' (rangeexpr / Action6) Action7)> */
 		func() bool {
-			position87, tokenIndex87, depth87 := position, tokenIndex, depth
+			position36, tokenIndex36, depth36 := position, tokenIndex, depth
 			{
-				position88 := position
+				position37 := position
 				depth++
 				if buffer[position] != rune('{') {
-					goto l87
+					goto l36
 				}
 				position++
 				{
-					position89, tokenIndex89, depth89 := position, tokenIndex, depth
+					position38, tokenIndex38, depth38 := position, tokenIndex, depth
 					if !_rules[rulecombinedexpr]() {
-						goto l89
+						goto l39
+					}
+					goto l38
+				l39:
+					position, tokenIndex, depth = position38, tokenIndex38, depth38
+					if !_rules[ruleAction5]() {
+						goto l36
 					}
-					goto l90
-				l89:
-					position, tokenIndex, depth = position89, tokenIndex89, depth89
 				}
-			l90:
+			l38:
 				if buffer[position] != rune('}') {
-					goto l87
+					goto l36
 				}
 				position++
 				{
-					position91, tokenIndex91, depth91 := position, tokenIndex, depth
+					position40, tokenIndex40, depth40 := position, tokenIndex, depth
 					if !_rules[rulerangeexpr]() {
-						goto l91
+						goto l41
+					}
+					goto l40
+				l41:
+					position, tokenIndex, depth = position40, tokenIndex40, depth40
+					if !_rules[ruleAction6]() {
+						goto l36
 					}
-					goto l92
-				l91:
-					position, tokenIndex, depth = position91, tokenIndex91, depth91
 				}
-			l92:
-				{
-					add(ruleAction4, position)
+			l40:
+				if !_rules[ruleAction7]() {
+					goto l36
 				}
 				depth--
-				add(rulebraces, position88)
+				add(rulebraces, position37)
 			}
 			return true
-		l87:
-			position, tokenIndex, depth = position87, tokenIndex87, depth87
+		l36:
+			position, tokenIndex, depth = position36, tokenIndex36, depth36
 			return false
 		},
-		/* 8 brackets <- <('(' combinedexpr? ')')> */
-		nil,
-		/* 9 clusterq <- <('*' rangeexpr Action5)> */
-		nil,
-		/* 10 groupq <- <('?' rangeexpr Action6)> */
-		nil,
-		/* 11 cluster <- <(('%' literal Action7 key?) / ('%' rangeexpr Action8 key?))> */
-		nil,
-		/* 12 group <- <('@' rangeexpr Action9)> */
-		nil,
-		/* 13 key <- <(':' rangeexpr Action10)> */
+		/* 8 brackets <- <('(' (combinedexpr / Action8) ')')> */
 		func() bool {
-			position99, tokenIndex99, depth99 := position, tokenIndex, depth
+			position42, tokenIndex42, depth42 := position, tokenIndex, depth
 			{
-				position100 := position
+				position43 := position
 				depth++
-				if buffer[position] != rune(':') {
-					goto l99
+				if buffer[position] != rune('(') {
+					goto l42
 				}
 				position++
-				if !_rules[rulerangeexpr]() {
-					goto l99
-				}
 				{
-					add(ruleAction10, position)
+					position44, tokenIndex44, depth44 := position, tokenIndex, depth
+					if !_rules[rulecombinedexpr]() {
+						goto l45
+					}
+					goto l44
+				l45:
+					position, tokenIndex, depth = position44, tokenIndex44, depth44
+					if !_rules[ruleAction8]() {
+						goto l42
+					}
 				}
+			l44:
+				if buffer[position] != rune(')') {
+					goto l42
+				}
+				position++
 				depth--
-				add(rulekey, position100)
+				add(rulebrackets, position43)
 			}
 			return true
-		l99:
-			position, tokenIndex, depth = position99, tokenIndex99, depth99
+		l42:
+			position, tokenIndex, depth = position42, tokenIndex42, depth42
 			return false
 		},
-		/* 14 localkey <- <('$' literal Action11)> */
-		nil,
-		/* 15 function <- <(literal Action12 '(' funcargs ')')> */
-		nil,
-		/* 16 funcargs <- <((combinedexpr? Action13 ';' funcargs) / (combinedexpr? Action14))> */
+		/* 9 clusterq <- <('*' rangeexpr Action9)> */
 		func() bool {
+			position46, tokenIndex46, depth46 := position, tokenIndex, depth
 			{
-				position105 := position
+				position47 := position
+				depth++
+				if buffer[position] != rune('*') {
+					goto l46
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l46
+				}
+				if !_rules[ruleAction9]() {
+					goto l46
+				}
+				depth--
+				add(ruleclusterq, position47)
+			}
+			return true
+		l46:
+			position, tokenIndex, depth = position46, tokenIndex46, depth46
+			return false
+		},
+		/* 10 groupq <- <('?' rangeexpr Action10)> */
+		func() bool {
+			position48, tokenIndex48, depth48 := position, tokenIndex, depth
+			{
+				position49 := position
+				depth++
+				if buffer[position] != rune('?') {
+					goto l48
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l48
+				}
+				if !_rules[ruleAction10]() {
+					goto l48
+				}
+				depth--
+				add(rulegroupq, position49)
+			}
+			return true
+		l48:
+			position, tokenIndex, depth = position48, tokenIndex48, depth48
+			return false
+		},
+		/* 11 cluster <- <(('%' literal Action11 key?) / ('%' rangeexpr Action12 key?))> */
+		func() bool {
+			position50, tokenIndex50, depth50 := position, tokenIndex, depth
+			{
+				position51 := position
 				depth++
 				{
-					position106, tokenIndex106, depth106 := position, tokenIndex, depth
+					position52, tokenIndex52, depth52 := position, tokenIndex, depth
+					if buffer[position] != rune('%') {
+						goto l53
+					}
+					position++
+					if !_rules[ruleliteral]() {
+						goto l53
+					}
+					if !_rules[ruleAction11]() {
+						goto l53
+					}
 					{
-						position108, tokenIndex108, depth108 := position, tokenIndex, depth
-						if !_rules[rulecombinedexpr]() {
-							goto l108
+						position54, tokenIndex54, depth54 := position, tokenIndex, depth
+						if !_rules[rulekey]() {
+							goto l54
 						}
-						goto l109
-					l108:
-						position, tokenIndex, depth = position108, tokenIndex108, depth108
+						goto l55
+					l54:
+						position, tokenIndex, depth = position54, tokenIndex54, depth54
+					}
+				l55:
+					goto l52
+				l53:
+					position, tokenIndex, depth = position52, tokenIndex52, depth52
+					if buffer[position] != rune('%') {
+						goto l50
+					}
+					position++
+					if !_rules[rulerangeexpr]() {
+						goto l50
+					}
+					if !_rules[ruleAction12]() {
+						goto l50
+					}
+					{
+						position56, tokenIndex56, depth56 := position, tokenIndex, depth
+						if !_rules[rulekey]() {
+							goto l56
+						}
+						goto l57
+					l56:
+						position, tokenIndex, depth = position56, tokenIndex56, depth56
+					}
+				l57:
+				}
+			l52:
+				depth--
+				add(rulecluster, position51)
+			}
+			return true
+		l50:
+			position, tokenIndex, depth = position50, tokenIndex50, depth50
+			return false
+		},
+		/* 12 group <- <('@' rangeexpr Action13)> */
+		func() bool {
+			position58, tokenIndex58, depth58 := position, tokenIndex, depth
+			{
+				position59 := position
+				depth++
+				if buffer[position] != rune('@') {
+					goto l58
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l58
+				}
+				if !_rules[ruleAction13]() {
+					goto l58
+				}
+				depth--
+				add(rulegroup, position59)
+			}
+			return true
+		l58:
+			position, tokenIndex, depth = position58, tokenIndex58, depth58
+			return false
+		},
+		/* 13 complement <- <('!' rangeexpr Action14)> */
+		func() bool {
+			position60, tokenIndex60, depth60 := position, tokenIndex, depth
+			{
+				position61 := position
+				depth++
+				if buffer[position] != rune('!') {
+					goto l60
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l60
+				}
+				if !_rules[ruleAction14]() {
+					goto l60
+				}
+				depth--
+				add(rulecomplement, position61)
+			}
+			return true
+		l60:
+			position, tokenIndex, depth = position60, tokenIndex60, depth60
+			return false
+		},
+		/* 14 key <- <(':' rangeexpr Action15)> */
+		func() bool {
+			position62, tokenIndex62, depth62 := position, tokenIndex, depth
+			{
+				position63 := position
+				depth++
+				if buffer[position] != rune(':') {
+					goto l62
+				}
+				position++
+				if !_rules[rulerangeexpr]() {
+					goto l62
+				}
+				if !_rules[ruleAction15]() {
+					goto l62
+				}
+				depth--
+				add(rulekey, position63)
+			}
+			return true
+		l62:
+			position, tokenIndex, depth = position62, tokenIndex62, depth62
+			return false
+		},
+		/* 15 localkey <- <('$' literal Action16)> */
+		func() bool {
+			position64, tokenIndex64, depth64 := position, tokenIndex, depth
+			{
+				position65 := position
+				depth++
+				if buffer[position] != rune('$') {
+					goto l64
+				}
+				position++
+				if !_rules[ruleliteral]() {
+					goto l64
+				}
+				if !_rules[ruleAction16]() {
+					goto l64
+				}
+				depth--
+				add(rulelocalkey, position65)
+			}
+			return true
+		l64:
+			position, tokenIndex, depth = position64, tokenIndex64, depth64
+			return false
+		},
+		/* 16 function <- <(literal Action17 '(' funcargs ')')> */
+		func() bool {
+			position66, tokenIndex66, depth66 := position, tokenIndex, depth
+			{
+				position67 := position
+				depth++
+				if !_rules[ruleliteral]() {
+					goto l66
+				}
+				if !_rules[ruleAction17]() {
+					goto l66
+				}
+				if buffer[position] != rune('(') {
+					goto l66
+				}
+				position++
+				if !_rules[rulefuncargs]() {
+					goto l66
+				}
+				if buffer[position] != rune(')') {
+					goto l66
+				}
+				position++
+				depth--
+				add(rulefunction, position67)
+			}
+			return true
+		l66:
+			position, tokenIndex, depth = position66, tokenIndex66, depth66
+			return false
+		},
+		/* 17 funcargs <- <((Action18 combinedexpr? Action19 ';' funcargs) / (Action20 combinedexpr? Action21))> */
+		func() bool {
+			position68, tokenIndex68, depth68 := position, tokenIndex, depth
+			{
+				position69 := position
+				depth++
+				{
+					position70, tokenIndex70, depth70 := position, tokenIndex, depth
+					if !_rules[ruleAction18]() {
+						goto l71
 					}
-				l109:
 					{
-						add(ruleAction13, position)
+						position72, tokenIndex72, depth72 := position, tokenIndex, depth
+						if !_rules[rulecombinedexpr]() {
+							goto l72
+						}
+						goto l73
+					l72:
+						position, tokenIndex, depth = position72, tokenIndex72, depth72
+					}
+				l73:
+					if !_rules[ruleAction19]() {
+						goto l71
 					}
 					if buffer[position] != rune(';') {
-						goto l107
+						goto l71
 					}
 					position++
 					if !_rules[rulefuncargs]() {
-						goto l107
+						goto l71
+					}
+					goto l70
+				l71:
+					position, tokenIndex, depth = position70, tokenIndex70, depth70
+					if !_rules[ruleAction20]() {
+						goto l68
 					}
-					goto l106
-				l107:
-					position, tokenIndex, depth = position106, tokenIndex106, depth106
 					{
-						position111, tokenIndex111, depth111 := position, tokenIndex, depth
+						position74, tokenIndex74, depth74 := position, tokenIndex, depth
 						if !_rules[rulecombinedexpr]() {
-							goto l111
+							goto l74
 						}
-						goto l112
-					l111:
-						position, tokenIndex, depth = position111, tokenIndex111, depth111
+						goto l75
+					l74:
+						position, tokenIndex, depth = position74, tokenIndex74, depth74
 					}
-				l112:
+				l75:
+					if !_rules[ruleAction21]() {
+						goto l68
+					}
+				}
+			l70:
+				depth--
+				add(rulefuncargs, position69)
+			}
+			return true
+		l68:
+			position, tokenIndex, depth = position68, tokenIndex68, depth68
+			return false
+		},
+		/* 18 regex <- <('/' <(!'/' .)*> '/' Action22)> */
+		func() bool {
+			position76, tokenIndex76, depth76 := position, tokenIndex, depth
+			{
+				position77 := position
+				depth++
+				if buffer[position] != rune('/') {
+					goto l76
+				}
+				position++
+				{
+					position78 := position
+					depth++
+				l79:
 					{
-						add(ruleAction14, position)
+						position80, tokenIndex80, depth80 := position, tokenIndex, depth
+						{
+							position81, tokenIndex81, depth81 := position, tokenIndex, depth
+							if buffer[position] != rune('/') {
+								goto l81
+							}
+							position++
+							goto l80
+						l81:
+							position, tokenIndex, depth = position81, tokenIndex81, depth81
+						}
+						if !matchDot() {
+							goto l80
+						}
+						goto l79
+					l80:
+						position, tokenIndex, depth = position80, tokenIndex80, depth80
 					}
+					depth--
+					add(rulePegText, position78)
+				}
+				if buffer[position] != rune('/') {
+					goto l76
+				}
+				position++
+				if !_rules[ruleAction22]() {
+					goto l76
 				}
-			l106:
 				depth--
-				add(rulefuncargs, position105)
+				add(ruleregex, position77)
 			}
 			return true
+		l76:
+			position, tokenIndex, depth = position76, tokenIndex76, depth76
+			return false
 		},
-		/* 17 regex <- <('/' <(!'/' .)*> '/' Action15)> */
-		nil,
-		/* 18 literal <- <<(leaderChar ((&('_') '_') | (&('-') '-') | (&('0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9') ([0-9] / [0-9])) | (&('A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'G' | 'H' | 'I' | 'J' | 'K' | 'L' | 'M' | 'N' | 'O' | 'P' | 'Q' | 'R' | 'S' | 'T' | 'U' | 'V' | 'W' | 'X' | 'Y' | 'Z') [A-Z]) | (&('a' | 'b' | 'c' | 'd' | 'e' | 'f' | 'g' | 'h' | 'i' | 'j' | 'k' | 'l' | 'm' | 'n' | 'o' | 'p' | 'q' | 'r' | 's' | 't' | 'u' | 'v' | 'w' | 'x' | 'y' | 'z') [a-z]))*)>> */
+		/* 19 literal <- <<(leaderChar ([a-z] / [A-Z] / ([0-9] / [0-9]) / '-' / '_' / letter)*)>> */
 		func() bool {
-			position115, tokenIndex115, depth115 := position, tokenIndex, depth
+			position82, tokenIndex82, depth82 := position, tokenIndex, depth
 			{
-				position116 := position
+				position83 := position
 				depth++
 				{
-					position117 := position
+					position84 := position
 					depth++
 					if !_rules[ruleleaderChar]() {
-						goto l115
+						goto l82
 					}
-				l118:
+				l85:
 					{
-						position119, tokenIndex119, depth119 := position, tokenIndex, depth
+						position86, tokenIndex86, depth86 := position, tokenIndex, depth
 						{
-							switch buffer[position] {
-							case '_':
-								if buffer[position] != rune('_') {
-									goto l119
-								}
-								position++
-								break
-							case '-':
-								if buffer[position] != rune('-') {
-									goto l119
-								}
-								position++
-								break
-							case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-								{
-									position121, tokenIndex121, depth121 := position, tokenIndex, depth
-									if c := buffer[position]; c < rune('0') || c > rune('9') {
-										goto l122
-									}
-									position++
-									goto l121
-								l122:
-									position, tokenIndex, depth = position121, tokenIndex121, depth121
-									if c := buffer[position]; c < rune('0') || c > rune('9') {
-										goto l119
-									}
-									position++
-								}
-							l121:
-								break
-							case 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z':
-								if c := buffer[position]; c < rune('A') || c > rune('Z') {
-									goto l119
+							position87, tokenIndex87, depth87 := position, tokenIndex, depth
+							if c := buffer[position]; c < rune('a') || c > rune('z') {
+								goto l88
+							}
+							position++
+							goto l87
+						l88:
+							position, tokenIndex, depth = position87, tokenIndex87, depth87
+							if c := buffer[position]; c < rune('A') || c > rune('Z') {
+								goto l89
+							}
+							position++
+							goto l87
+						l89:
+							position, tokenIndex, depth = position87, tokenIndex87, depth87
+							{
+								position91, tokenIndex91, depth91 := position, tokenIndex, depth
+								if c := buffer[position]; c < rune('0') || c > rune('9') {
+									goto l92
 								}
 								position++
-								break
-							default:
-								if c := buffer[position]; c < rune('a') || c > rune('z') {
-									goto l119
+								goto l91
+							l92:
+								position, tokenIndex, depth = position91, tokenIndex91, depth91
+								if c := buffer[position]; c < rune('0') || c > rune('9') {
+									goto l90
 								}
 								position++
-								break
+							}
+						l91:
+							goto l87
+						l90:
+							position, tokenIndex, depth = position87, tokenIndex87, depth87
+							if buffer[position] != rune('-') {
+								goto l93
+							}
+							position++
+							goto l87
+						l93:
+							position, tokenIndex, depth = position87, tokenIndex87, depth87
+							if buffer[position] != rune('_') {
+								goto l94
+							}
+							position++
+							goto l87
+						l94:
+							position, tokenIndex, depth = position87, tokenIndex87, depth87
+							if !_rules[ruleletter]() {
+								goto l86
 							}
 						}
-
-						goto l118
-					l119:
-						position, tokenIndex, depth = position119, tokenIndex119, depth119
+					l87:
+						goto l85
+					l86:
+						position, tokenIndex, depth = position86, tokenIndex86, depth86
 					}
 					depth--
-					add(rulePegText, position117)
+					add(rulePegText, position84)
 				}
 				depth--
-				add(ruleliteral, position116)
+				add(ruleliteral, position83)
 			}
 			return true
-		l115:
-			position, tokenIndex, depth = position115, tokenIndex115, depth115
+		l82:
+			position, tokenIndex, depth = position82, tokenIndex82, depth82
 			return false
 		},
-		/* 19 value <- <(<(leaderChar ((&('.') '.') | (&('_') '_') | (&('-') '-') | (&('0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9') ([0-9] / [0-9])) | (&(':') ':') | (&('A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'G' | 'H' | 'I' | 'J' | 'K' | 'L' | 'M' | 'N' | 'O' | 'P' | 'Q' | 'R' | 'S' | 'T' | 'U' | 'V' | 'W' | 'X' | 'Y' | 'Z' | 'a' | 'b' | 'c' | 'd' | 'e' | 'f' | 'g' | 'h' | 'i' | 'j' | 'k' | 'l' | 'm' | 'n' | 'o' | 'p' | 'q' | 'r' | 's' | 't' | 'u' | 'v' | 'w' | 'x' | 'y' | 'z') ([a-z] / [A-Z])))*)> Action16)> */
-		nil,
-		/* 20 leaderChar <- <((&('_') '_') | (&('.') '.') | (&('0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9') ([0-9] / [0-9])) | (&('A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'G' | 'H' | 'I' | 'J' | 'K' | 'L' | 'M' | 'N' | 'O' | 'P' | 'Q' | 'R' | 'S' | 'T' | 'U' | 'V' | 'W' | 'X' | 'Y' | 'Z') [A-Z]) | (&('a' | 'b' | 'c' | 'd' | 'e' | 'f' | 'g' | 'h' | 'i' | 'j' | 'k' | 'l' | 'm' | 'n' | 'o' | 'p' | 'q' | 'r' | 's' | 't' | 'u' | 'v' | 'w' | 'x' | 'y' | 'z') [a-z]))> */
+		/* 20 value <- <(<(leaderChar valueChar* (step valueChar*)?)> Action23)> */
 		func() bool {
-			position124, tokenIndex124, depth124 := position, tokenIndex, depth
+			position95, tokenIndex95, depth95 := position, tokenIndex, depth
 			{
-				position125 := position
+				position96 := position
 				depth++
 				{
-					switch buffer[position] {
-					case '_':
-						if buffer[position] != rune('_') {
-							goto l124
+					position97 := position
+					depth++
+					if !_rules[ruleleaderChar]() {
+						goto l95
+					}
+				l98:
+					{
+						position99, tokenIndex99, depth99 := position, tokenIndex, depth
+						if !_rules[rulevalueChar]() {
+							goto l99
 						}
-						position++
-						break
-					case '.':
-						if buffer[position] != rune('.') {
-							goto l124
+						goto l98
+					l99:
+						position, tokenIndex, depth = position99, tokenIndex99, depth99
+					}
+					{
+						position100, tokenIndex100, depth100 := position, tokenIndex, depth
+						if !_rules[rulestep]() {
+							goto l100
 						}
-						position++
-						break
-					case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+					l102:
 						{
-							position127, tokenIndex127, depth127 := position, tokenIndex, depth
-							if c := buffer[position]; c < rune('0') || c > rune('9') {
-								goto l128
-							}
-							position++
-							goto l127
-						l128:
-							position, tokenIndex, depth = position127, tokenIndex127, depth127
-							if c := buffer[position]; c < rune('0') || c > rune('9') {
-								goto l124
+							position103, tokenIndex103, depth103 := position, tokenIndex, depth
+							if !_rules[rulevalueChar]() {
+								goto l103
 							}
-							position++
+							goto l102
+						l103:
+							position, tokenIndex, depth = position103, tokenIndex103, depth103
 						}
-					l127:
-						break
-					case 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z':
-						if c := buffer[position]; c < rune('A') || c > rune('Z') {
-							goto l124
-						}
-						position++
-						break
-					default:
-						if c := buffer[position]; c < rune('a') || c > rune('z') {
-							goto l124
-						}
-						position++
-						break
+						goto l101
+					l100:
+						position, tokenIndex, depth = position100, tokenIndex100, depth100
 					}
+				l101:
+					depth--
+					add(rulePegText, position97)
+				}
+				if !_rules[ruleAction23]() {
+					goto l95
 				}
-
 				depth--
-				add(ruleleaderChar, position125)
+				add(rulevalue, position96)
 			}
 			return true
-		l124:
-			position, tokenIndex, depth = position124, tokenIndex124, depth124
+		l95:
+			position, tokenIndex, depth = position95, tokenIndex95, depth95
 			return false
 		},
-		/* 21 space <- <' '*> */
+		/* 21 valueChar <- <(':' / ([a-z] / [A-Z]) / ([0-9] / [0-9]) / '-' / '_' / '.' / letter)> */
 		func() bool {
+			position104, tokenIndex104, depth104 := position, tokenIndex, depth
 			{
-				position130 := position
+				position105 := position
 				depth++
-			l131:
 				{
-					position132, tokenIndex132, depth132 := position, tokenIndex, depth
-					if buffer[position] != rune(' ') {
-						goto l132
+					position106, tokenIndex106, depth106 := position, tokenIndex, depth
+					if buffer[position] != rune(':') {
+						goto l107
 					}
 					position++
-					goto l131
-				l132:
-					position, tokenIndex, depth = position132, tokenIndex132, depth132
+					goto l106
+				l107:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					{
+						position109, tokenIndex109, depth109 := position, tokenIndex, depth
+						if c := buffer[position]; c < rune('a') || c > rune('z') {
+							goto l110
+						}
+						position++
+						goto l109
+					l110:
+						position, tokenIndex, depth = position109, tokenIndex109, depth109
+						if c := buffer[position]; c < rune('A') || c > rune('Z') {
+							goto l108
+						}
+						position++
+					}
+				l109:
+					goto l106
+				l108:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					{
+						position112, tokenIndex112, depth112 := position, tokenIndex, depth
+						if c := buffer[position]; c < rune('0') || c > rune('9') {
+							goto l113
+						}
+						position++
+						goto l112
+					l113:
+						position, tokenIndex, depth = position112, tokenIndex112, depth112
+						if c := buffer[position]; c < rune('0') || c > rune('9') {
+							goto l111
+						}
+						position++
+					}
+				l112:
+					goto l106
+				l111:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					if buffer[position] != rune('-') {
+						goto l114
+					}
+					position++
+					goto l106
+				l114:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					if buffer[position] != rune('_') {
+						goto l115
+					}
+					position++
+					goto l106
+				l115:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					if buffer[position] != rune('.') {
+						goto l116
+					}
+					position++
+					goto l106
+				l116:
+					position, tokenIndex, depth = position106, tokenIndex106, depth106
+					if !_rules[ruleletter]() {
+						goto l104
+					}
 				}
+			l106:
 				depth--
-				add(rulespace, position130)
+				add(rulevalueChar, position105)
+			}
+			return true
+		l104:
+			position, tokenIndex, depth = position104, tokenIndex104, depth104
+			return false
+		},
+		/* 22 step <- <('/' [0-9]+)> */
+		func() bool {
+			position117, tokenIndex117, depth117 := position, tokenIndex, depth
+			{
+				position118 := position
+				depth++
+				if buffer[position] != rune('/') {
+					goto l117
+				}
+				position++
+				if c := buffer[position]; c < rune('0') || c > rune('9') {
+					goto l117
+				}
+				position++
+			l119:
+				{
+					position120, tokenIndex120, depth120 := position, tokenIndex, depth
+					if c := buffer[position]; c < rune('0') || c > rune('9') {
+						goto l120
+					}
+					position++
+					goto l119
+				l120:
+					position, tokenIndex, depth = position120, tokenIndex120, depth120
+				}
+				depth--
+				add(rulestep, position118)
+			}
+			return true
+		l117:
+			position, tokenIndex, depth = position117, tokenIndex117, depth117
+			return false
+		},
+		/* 23 leaderChar <- <([a-z] / [A-Z] / ([0-9] / [0-9]) / '.' / '_' / letter)> */
+		func() bool {
+			position121, tokenIndex121, depth121 := position, tokenIndex, depth
+			{
+				position122 := position
+				depth++
+				{
+					position123, tokenIndex123, depth123 := position, tokenIndex, depth
+					if c := buffer[position]; c < rune('a') || c > rune('z') {
+						goto l124
+					}
+					position++
+					goto l123
+				l124:
+					position, tokenIndex, depth = position123, tokenIndex123, depth123
+					if c := buffer[position]; c < rune('A') || c > rune('Z') {
+						goto l125
+					}
+					position++
+					goto l123
+				l125:
+					position, tokenIndex, depth = position123, tokenIndex123, depth123
+					{
+						position127, tokenIndex127, depth127 := position, tokenIndex, depth
+						if c := buffer[position]; c < rune('0') || c > rune('9') {
+							goto l128
+						}
+						position++
+						goto l127
+					l128:
+						position, tokenIndex, depth = position127, tokenIndex127, depth127
+						if c := buffer[position]; c < rune('0') || c > rune('9') {
+							goto l126
+						}
+						position++
+					}
+				l127:
+					goto l123
+				l126:
+					position, tokenIndex, depth = position123, tokenIndex123, depth123
+					if buffer[position] != rune('.') {
+						goto l129
+					}
+					position++
+					goto l123
+				l129:
+					position, tokenIndex, depth = position123, tokenIndex123, depth123
+					if buffer[position] != rune('_') {
+						goto l130
+					}
+					position++
+					goto l123
+				l130:
+					position, tokenIndex, depth = position123, tokenIndex123, depth123
+					if !_rules[ruleletter]() {
+						goto l121
+					}
+				}
+			l123:
+				depth--
+				add(ruleleaderChar, position122)
+			}
+			return true
+		l121:
+			position, tokenIndex, depth = position121, tokenIndex121, depth121
+			return false
+		},
+		/* 24 letter <- <(&{ p.unicode && unicode.IsLetter(buffer[position]) } .)> */
+		func() bool {
+			position131, tokenIndex131, depth131 := position, tokenIndex, depth
+			{
+				position132 := position
+				depth++
+				if !(p.unicode && unicode.IsLetter(buffer[position])) {
+					goto l131
+				}
+				if !matchDot() {
+					goto l131
+				}
+				depth--
+				add(ruleletter, position132)
+			}
+			return true
+		l131:
+			position, tokenIndex, depth = position131, tokenIndex131, depth131
+			return false
+		},
+		/* 25 space <- <' '*> */
+		func() bool {
+			{
+				position134 := position
+				depth++
+			l135:
+				{
+					position136, tokenIndex136, depth136 := position, tokenIndex, depth
+					if buffer[position] != rune(' ') {
+						goto l136
+					}
+					position++
+					goto l135
+				l136:
+					position, tokenIndex, depth = position136, tokenIndex136, depth136
+				}
+				depth--
+				add(rulespace, position134)
+			}
+			return true
+		},
+		/* 26 const <- <(q / quoted / raw)> */
+		func() bool {
+			position137, tokenIndex137, depth137 := position, tokenIndex, depth
+			{
+				position138 := position
+				depth++
+				{
+					position139, tokenIndex139, depth139 := position, tokenIndex, depth
+					if !_rules[ruleq]() {
+						goto l140
+					}
+					goto l139
+				l140:
+					position, tokenIndex, depth = position139, tokenIndex139, depth139
+					if !_rules[rulequoted]() {
+						goto l141
+					}
+					goto l139
+				l141:
+					position, tokenIndex, depth = position139, tokenIndex139, depth139
+					if !_rules[ruleraw]() {
+						goto l137
+					}
+				}
+			l139:
+				depth--
+				add(ruleconst, position138)
+			}
+			return true
+		l137:
+			position, tokenIndex, depth = position137, tokenIndex137, depth137
+			return false
+		},
+		/* 27 q <- <('q' '(' <(!')' .)*> ')' Action24)> */
+		func() bool {
+			position142, tokenIndex142, depth142 := position, tokenIndex, depth
+			{
+				position143 := position
+				depth++
+				if buffer[position] != rune('q') {
+					goto l142
+				}
+				position++
+				if buffer[position] != rune('(') {
+					goto l142
+				}
+				position++
+				{
+					position144 := position
+					depth++
+				l145:
+					{
+						position146, tokenIndex146, depth146 := position, tokenIndex, depth
+						{
+							position147, tokenIndex147, depth147 := position, tokenIndex, depth
+							if buffer[position] != rune(')') {
+								goto l147
+							}
+							position++
+							goto l146
+						l147:
+							position, tokenIndex, depth = position147, tokenIndex147, depth147
+						}
+						if !matchDot() {
+							goto l146
+						}
+						goto l145
+					l146:
+						position, tokenIndex, depth = position146, tokenIndex146, depth146
+					}
+					depth--
+					add(rulePegText, position144)
+				}
+				if buffer[position] != rune(')') {
+					goto l142
+				}
+				position++
+				if !_rules[ruleAction24]() {
+					goto l142
+				}
+				depth--
+				add(ruleq, position143)
+			}
+			return true
+		l142:
+			position, tokenIndex, depth = position142, tokenIndex142, depth142
+			return false
+		},
+		/* 28 quoted <- <('"' <(escape / (!'"' !'\\' .))*> '"' Action25)> */
+		func() bool {
+			position148, tokenIndex148, depth148 := position, tokenIndex, depth
+			{
+				position149 := position
+				depth++
+				if buffer[position] != rune('"') {
+					goto l148
+				}
+				position++
+				{
+					position150 := position
+					depth++
+				l151:
+					{
+						position152, tokenIndex152, depth152 := position, tokenIndex, depth
+						{
+							position153, tokenIndex153, depth153 := position, tokenIndex, depth
+							if !_rules[ruleescape]() {
+								goto l154
+							}
+							goto l153
+						l154:
+							position, tokenIndex, depth = position153, tokenIndex153, depth153
+							{
+								position155, tokenIndex155, depth155 := position, tokenIndex, depth
+								if buffer[position] != rune('"') {
+									goto l155
+								}
+								position++
+								goto l152
+							l155:
+								position, tokenIndex, depth = position155, tokenIndex155, depth155
+							}
+							{
+								position156, tokenIndex156, depth156 := position, tokenIndex, depth
+								if buffer[position] != rune('\\') {
+									goto l156
+								}
+								position++
+								goto l152
+							l156:
+								position, tokenIndex, depth = position156, tokenIndex156, depth156
+							}
+							if !matchDot() {
+								goto l152
+							}
+						}
+					l153:
+						goto l151
+					l152:
+						position, tokenIndex, depth = position152, tokenIndex152, depth152
+					}
+					depth--
+					add(rulePegText, position150)
+				}
+				if buffer[position] != rune('"') {
+					goto l148
+				}
+				position++
+				if !_rules[ruleAction25]() {
+					goto l148
+				}
+				depth--
+				add(rulequoted, position149)
+			}
+			return true
+		l148:
+			position, tokenIndex, depth = position148, tokenIndex148, depth148
+			return false
+		},
+		/* 29 raw <- <('\'' <(!'\'' .)*> '\'' Action26)> */
+		func() bool {
+			position157, tokenIndex157, depth157 := position, tokenIndex, depth
+			{
+				position158 := position
+				depth++
+				if buffer[position] != rune('\'') {
+					goto l157
+				}
+				position++
+				{
+					position159 := position
+					depth++
+				l160:
+					{
+						position161, tokenIndex161, depth161 := position, tokenIndex, depth
+						{
+							position162, tokenIndex162, depth162 := position, tokenIndex, depth
+							if buffer[position] != rune('\'') {
+								goto l162
+							}
+							position++
+							goto l161
+						l162:
+							position, tokenIndex, depth = position162, tokenIndex162, depth162
+						}
+						if !matchDot() {
+							goto l161
+						}
+						goto l160
+					l161:
+						position, tokenIndex, depth = position161, tokenIndex161, depth161
+					}
+					depth--
+					add(rulePegText, position159)
+				}
+				if buffer[position] != rune('\'') {
+					goto l157
+				}
+				position++
+				if !_rules[ruleAction26]() {
+					goto l157
+				}
+				depth--
+				add(ruleraw, position158)
+			}
+			return true
+		l157:
+			position, tokenIndex, depth = position157, tokenIndex157, depth157
+			return false
+		},
+		/* 30 escape <- <('\\' ('a' / 'b' / 'f' / 'n' / 'r' / 't' / 'v' / '"' / '\'' / '\\' / ('x' hex hex) / ('u' hex hex hex hex) / ('U' hex hex hex hex hex hex hex hex) / ([0-7] [0-7] [0-7])))> */
+		func() bool {
+			position163, tokenIndex163, depth163 := position, tokenIndex, depth
+			{
+				position164 := position
+				depth++
+				if buffer[position] != rune('\\') {
+					goto l163
+				}
+				position++
+				{
+					position165, tokenIndex165, depth165 := position, tokenIndex, depth
+					if buffer[position] != rune('a') {
+						goto l166
+					}
+					position++
+					goto l165
+				l166:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('b') {
+						goto l167
+					}
+					position++
+					goto l165
+				l167:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('f') {
+						goto l168
+					}
+					position++
+					goto l165
+				l168:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('n') {
+						goto l169
+					}
+					position++
+					goto l165
+				l169:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('r') {
+						goto l170
+					}
+					position++
+					goto l165
+				l170:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('t') {
+						goto l171
+					}
+					position++
+					goto l165
+				l171:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('v') {
+						goto l172
+					}
+					position++
+					goto l165
+				l172:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('"') {
+						goto l173
+					}
+					position++
+					goto l165
+				l173:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('\'') {
+						goto l174
+					}
+					position++
+					goto l165
+				l174:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('\\') {
+						goto l175
+					}
+					position++
+					goto l165
+				l175:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('x') {
+						goto l176
+					}
+					position++
+					if !_rules[rulehex]() {
+						goto l176
+					}
+					if !_rules[rulehex]() {
+						goto l176
+					}
+					goto l165
+				l176:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('u') {
+						goto l177
+					}
+					position++
+					if !_rules[rulehex]() {
+						goto l177
+					}
+					if !_rules[rulehex]() {
+						goto l177
+					}
+					if !_rules[rulehex]() {
+						goto l177
+					}
+					if !_rules[rulehex]() {
+						goto l177
+					}
+					goto l165
+				l177:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if buffer[position] != rune('U') {
+						goto l178
+					}
+					position++
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					if !_rules[rulehex]() {
+						goto l178
+					}
+					goto l165
+				l178:
+					position, tokenIndex, depth = position165, tokenIndex165, depth165
+					if c := buffer[position]; c < rune('0') || c > rune('7') {
+						goto l163
+					}
+					position++
+					if c := buffer[position]; c < rune('0') || c > rune('7') {
+						goto l163
+					}
+					position++
+					if c := buffer[position]; c < rune('0') || c > rune('7') {
+						goto l163
+					}
+					position++
+				}
+			l165:
+				depth--
+				add(ruleescape, position164)
+			}
+			return true
+		l163:
+			position, tokenIndex, depth = position163, tokenIndex163, depth163
+			return false
+		},
+		/* 31 hex <- <([0-9] / [a-f] / [A-F])> */
+		func() bool {
+			position179, tokenIndex179, depth179 := position, tokenIndex, depth
+			{
+				position180 := position
+				depth++
+				{
+					position181, tokenIndex181, depth181 := position, tokenIndex, depth
+					if c := buffer[position]; c < rune('0') || c > rune('9') {
+						goto l182
+					}
+					position++
+					goto l181
+				l182:
+					position, tokenIndex, depth = position181, tokenIndex181, depth181
+					if c := buffer[position]; c < rune('a') || c > rune('f') {
+						goto l183
+					}
+					position++
+					goto l181
+				l183:
+					position, tokenIndex, depth = position181, tokenIndex181, depth181
+					if c := buffer[position]; c < rune('A') || c > rune('F') {
+						goto l179
+					}
+					position++
+				}
+			l181:
+				depth--
+				add(rulehex, position180)
+			}
+			return true
+		l179:
+			position, tokenIndex, depth = position179, tokenIndex179, depth179
+			return false
+		},
+		/* 33 Action0 <- <{ p.addNull() }> */
+		func() bool {
+			{
+				add(ruleAction0, position)
+			}
+			return true
+		},
+		/* 34 Action1 <- <{ p.addOperator(operatorUnion) }> */
+		func() bool {
+			{
+				add(ruleAction1, position)
+			}
+			return true
+		},
+		/* 35 Action2 <- <{ p.addOperator(operatorSubtract) }> */
+		func() bool {
+			{
+				add(ruleAction2, position)
+			}
+			return true
+		},
+		/* 36 Action3 <- <{ p.addOperator(operatorIntersect) }> */
+		func() bool {
+			{
+				add(ruleAction3, position)
+			}
+			return true
+		},
+		/* 37 Action4 <- <{ p.addOperator(operatorSymmetricDifference) }> */
+		func() bool {
+			{
+				add(ruleAction4, position)
+			}
+			return true
+		},
+		/* 38 Action5 <- <{ p.addNull() }> */
+		func() bool {
+			{
+				add(ruleAction5, position)
+			}
+			return true
+		},
+		/* 39 Action6 <- <{ p.addNull() }> */
+		func() bool {
+			{
+				add(ruleAction6, position)
+			}
+			return true
+		},
+		/* 40 Action7 <- <{ p.addBraces() }> */
+		func() bool {
+			{
+				add(ruleAction7, position)
+			}
+			return true
+		},
+		/* 41 Action8 <- <{ p.addNull() }> */
+		func() bool {
+			{
+				add(ruleAction8, position)
+			}
+			return true
+		},
+		/* 42 Action9 <- <{ p.addClusterQuery() }> */
+		func() bool {
+			{
+				add(ruleAction9, position)
+			}
+			return true
+		},
+		/* 43 Action10 <- <{ p.addGroupQuery() }> */
+		func() bool {
+			{
+				add(ruleAction10, position)
+			}
+			return true
+		},
+		/* 44 Action11 <- <{ p.addValue(text); p.addClusterLookup() }> */
+		func() bool {
+			{
+				add(ruleAction11, position)
+			}
+			return true
+		},
+		/* 45 Action12 <- <{ p.addClusterLookup() }> */
+		func() bool {
+			{
+				add(ruleAction12, position)
+			}
+			return true
+		},
+		/* 46 Action13 <- <{ p.addGroupLookup() }> */
+		func() bool {
+			{
+				add(ruleAction13, position)
+			}
+			return true
+		},
+		/* 47 Action14 <- <{ p.addComplement() }> */
+		func() bool {
+			{
+				add(ruleAction14, position)
+			}
+			return true
+		},
+		/* 48 Action15 <- <{ p.addKeyLookup() }> */
+		func() bool {
+			{
+				add(ruleAction15, position)
+			}
+			return true
+		},
+		/* 49 Action16 <- <{ p.addLocalClusterLookup(text) }> */
+		func() bool {
+			{
+				add(ruleAction16, position)
+			}
+			return true
+		},
+		/* 50 Action17 <- <{ p.addFunction(text) }> */
+		func() bool {
+			{
+				add(ruleAction17, position)
+			}
+			return true
+		},
+		/* 51 Action18 <- <{ p.addFuncArgStart() }> */
+		func() bool {
+			{
+				add(ruleAction18, position)
+			}
+			return true
+		},
+		/* 52 Action19 <- <{ p.addFuncArg() }> */
+		func() bool {
+			{
+				add(ruleAction19, position)
+			}
+			return true
+		},
+		/* 53 Action20 <- <{ p.addFuncArgStart() }> */
+		func() bool {
+			{
+				add(ruleAction20, position)
+			}
+			return true
+		},
+		/* 54 Action21 <- <{ p.addFuncArg() }> */
+		func() bool {
+			{
+				add(ruleAction21, position)
 			}
 			return true
 		},
-		/* 22 const <- <(q / quoted)> */
-		nil,
-		/* 23 q <- <('q' '(' <(!')' .)*> ')' Action17)> */
-		nil,
-		/* 24 quoted <- <('"' <(!'"' .)*> '"' Action18)> */
-		nil,
-		/* 26 Action0 <- <{ p.addBraceStart() }> */
-		nil,
-		/* 27 Action1 <- <{ p.addOperator(operatorIntersect) }> */
-		nil,
-		/* 28 Action2 <- <{ p.addOperator(operatorSubtract) }> */
-		nil,
-		/* 29 Action3 <- <{ p.addOperator(operatorUnion) }> */
-		nil,
-		/* 30 Action4 <- <{ p.addBraces() }> */
-		nil,
-		/* 31 Action5 <- <{ p.addClusterQuery() }> */
-		nil,
-		/* 32 Action6 <- <{ p.addGroupQuery() }> */
-		nil,
-		/* 33 Action7 <- <{ p.addValue(buffer[begin:end]); p.addClusterLookup() }> */
-		nil,
-		/* 34 Action8 <- <{ p.addClusterLookup() }> */
-		nil,
-		/* 35 Action9 <- <{ p.addGroupLookup() }> */
-		nil,
-		/* 36 Action10 <- <{ p.addKeyLookup() }> */
-		nil,
-		/* 37 Action11 <- <{ p.addLocalClusterLookup(buffer[begin:end]) }> */
-		nil,
-		/* 38 Action12 <- <{ p.addFunction(buffer[begin:end]) }> */
-		nil,
-		/* 39 Action13 <- <{ p.addFuncArg() }> */
-		nil,
-		/* 40 Action14 <- <{ p.addFuncArg() }> */
-		nil,
-		nil,
-		/* 42 Action15 <- <{ p.addRegex(buffer[begin:end]) }> */
-		nil,
-		/* 43 Action16 <- <{ p.addValue(buffer[begin:end]) }> */
-		nil,
-		/* 44 Action17 <- <{ p.addConstant(buffer[begin:end]) }> */
-		nil,
-		/* 45 Action18 <- <{ p.addConstant(buffer[begin:end]) }> */
 		nil,
+		/* 56 Action22 <- <{ p.addRegex(text) }> */
+		func() bool {
+			{
+				add(ruleAction22, position)
+			}
+			return true
+		},
+		/* 57 Action23 <- <{ p.addValue(text) }> */
+		func() bool {
+			{
+				add(ruleAction23, position)
+			}
+			return true
+		},
+		/* 58 Action24 <- <{ p.addConstant(text) }> */
+		func() bool {
+			{
+				add(ruleAction24, position)
+			}
+			return true
+		},
+		/* 59 Action25 <- <{ p.addQuoted(text, begin) }> */
+		func() bool {
+			{
+				add(ruleAction25, position)
+			}
+			return true
+		},
+		/* 60 Action26 <- <{ p.addConstant(text) }> */
+		func() bool {
+			{
+				add(ruleAction26, position)
+			}
+			return true
+		},
 	}
 	p.rules = _rules
 }
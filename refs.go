@@ -0,0 +1,412 @@
+package grange
+
+import (
+	"sort"
+)
+
+// A Reference is a place where a stored value uses the values of a cluster
+// key, found by parsing the value rather than evaluating it.
+type Reference struct {
+	// The cluster and key whose value contains the reference, and the value.
+	Cluster string
+	Key     string
+	Value   string
+
+	// How the value refers to the target: "%" and "@" for cluster lookups,
+	// "$" for keys of the same cluster, "?" for group queries, "!" and "/" for
+	// the values complements and regexes are taken from, or a function such
+	// as "has()".
+	Kind string
+
+	// The cluster and key referred to. Target is empty if the reference could
+	// be to any cluster, such as has() which looks at every cluster, or
+	// %{...} when the cluster name is only known after evaluation. Likewise
+	// TargetKey is empty if it could be any key.
+	Target    string
+	TargetKey string
+}
+
+// ReferencesTo returns the references to a key of a cluster in the values of
+// every cluster, or to any of its keys if key is empty. For example, when
+// decommissioning a cluster, ReferencesTo("dc1", "") lists each value that
+// mentions %dc1 or @dc1. References that could be to any cluster, such as
+// has(), are not included; AffectedKeys takes them into account.
+func (state *State) ReferencesTo(cluster string, key string) ([]Reference, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	refs, err := state.references(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Reference{}
+	for _, ref := range refs {
+		if ref.Target == state.fold(cluster) && ref.refersTo(ref.Target, state.fold(key)) {
+			result = append(result, ref)
+		}
+	}
+	return result, nil
+}
+
+// DependenciesOf returns the references in the values of a key of a cluster,
+// or of any of its keys if key is empty.
+func (state *State) DependenciesOf(cluster string, key string) ([]Reference, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	refs, err := state.references(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Reference{}
+	for _, ref := range refs {
+		if ref.Cluster == state.fold(cluster) && (key == "" || ref.Key == state.fold(key)) {
+			result = append(result, ref)
+		}
+	}
+	return result, nil
+}
+
+// refersTo reports whether the reference could use the values of a key, or
+// if key is empty, any key of the cluster.
+func (r Reference) refersTo(cluster string, key string) bool {
+	return (r.Target == "" || r.Target == cluster) &&
+		(r.TargetKey == "" || key == "" || r.TargetKey == key || r.TargetKey == "KEYS")
+}
+
+// references returns the references contained in every value of every
+// cluster. The values are only parsed the first time they are needed after a
+// change to the state; when that happens during a query, each key parsed is
+// charged to context as a lookup. context may be nil outside of queries.
+func (state *State) references(context *evalContext) ([]Reference, error) {
+	clusters, err := state.allClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	state.refsMutex.Lock()
+	refs := state.refs
+	state.refsMutex.Unlock()
+	if refs != nil {
+		return refs, nil
+	}
+
+	refs = parseReferences(state, clusters, context)
+
+	state.refsMutex.Lock()
+	state.refs = refs
+	state.refsMutex.Unlock()
+	return refs, nil
+}
+
+// resetReferences discards the references, after a change to the clusters or
+// to the settings they were found with, such as the default cluster.
+func (state *State) resetReferences() {
+	state.refsMutex.Lock()
+	defer state.refsMutex.Unlock()
+
+	state.refs = nil
+}
+
+// parseReferences parses every value of the given clusters. Values that do
+// not parse cannot refer to anything, so are skipped.
+func parseReferences(state *State, clusters map[string]Cluster, context *evalContext) []Reference {
+	refs := []Reference{}
+	for name, cluster := range clusters {
+		if context != nil {
+			context.charge(costLookup, len(cluster))
+		}
+		for key, values := range cluster {
+			for _, value := range values {
+				node, err := parseRange(value, state.unicodeIdentifiers)
+				if err != nil {
+					continue
+				}
+				w := referenceWalker{state, name, key, value, &refs}
+				w.walk(node, false)
+			}
+		}
+	}
+	sort.Sort(references(refs))
+	return refs
+}
+
+// referenceWalker collects the references in a parsed value, mirroring how
+// the value would be evaluated.
+type referenceWalker struct {
+	state   *State
+	cluster string
+	key     string
+	value   string
+	refs    *[]Reference
+}
+
+func (w referenceWalker) add(kind string, target string, targetKey string) {
+	*w.refs = append(*w.refs,
+		Reference{w.cluster, w.key, w.value, kind, target, targetKey})
+}
+
+// walk adds the references in node. A regex is filtered if it matches
+// against a result computed elsewhere, such as the left side of an
+// intersection, otherwise it matches against every value.
+func (w referenceWalker) walk(node parserNode, filtered bool) {
+	switch n := node.(type) {
+	case nodeLocalClusterLookup:
+		w.add("$", w.cluster, w.state.fold(n.key))
+	case nodeClusterLookup:
+		kind := "%"
+		if c, ok := n.node.(nodeConstant); ok && c.val == "GROUPS" {
+			kind = "@"
+		}
+
+		targets := w.static(n.node)
+		if targets == nil {
+			targets = []string{""}
+			w.walk(n.node, false)
+		}
+		keys := w.static(n.key)
+		if keys == nil {
+			keys = []string{""}
+			w.walk(n.key, false)
+		}
+		for _, target := range targets {
+			for _, key := range keys {
+				w.add(kind, target, key)
+			}
+		}
+	case nodeGroupQuery:
+		w.add("?", w.state.fold(w.state.defaultCluster), "")
+		w.walk(n.node, false)
+	case nodeComplement:
+		w.universe("!")
+		w.walk(n.node, true)
+	case nodeRegexp:
+		if !filtered {
+			w.universe("/")
+		}
+	case nodeOperator:
+		w.walk(n.left, filtered)
+		w.walk(n.right, filtered ||
+			n.op == operatorIntersect || n.op == operatorSubtract)
+	case nodeBraces:
+		w.walk(n.left, false)
+		w.walk(n.node, false)
+		w.walk(n.right, false)
+	case nodeFunction:
+		w.walkFunction(n)
+	}
+}
+
+func (w referenceWalker) walkFunction(n nodeFunction) {
+	name := w.state.fold(n.name)
+	kind := name + "()"
+
+	// Parameters that are regexes are matched against other parameters.
+	regexParam := -1
+	switch name {
+	case "allclusters", "refs", "deps":
+		w.add(kind, "", "")
+	case "clusters":
+		w.add(kind, "", "CLUSTER")
+	case "has", "hasall", "hasnot", "lacks":
+		keys := []string{""}
+		if len(n.params) > 0 {
+			if static := w.static(n.params[0]); static != nil {
+				keys = static
+			}
+		}
+		for _, key := range keys {
+			w.add(kind, "", key)
+		}
+		regexParam = 1
+	case "not":
+		w.universe("!")
+		regexParam = 0
+	case "sub", "extract":
+		regexParam = 1
+	}
+
+	for i, param := range n.params {
+		w.walk(param, i == regexParam)
+	}
+}
+
+// universe adds a reference to the values that complements are taken
+// relative to. See SetUniverseKey.
+func (w referenceWalker) universe(kind string) {
+	w.add(kind, w.state.fold(w.state.defaultCluster), w.state.fold(w.state.universeKey))
+}
+
+// static returns the values of a node that does not depend on any cluster,
+// such as a cluster name in %dc1..3, or nil if it does.
+func (w referenceWalker) static(node parserNode) (values []string) {
+	if !isStatic(node) {
+		return nil
+	}
+
+	// Too many results, such as from a huge numeric range, could refer to
+	// anything.
+	defer func() {
+		if recover() != nil {
+			values = nil
+		}
+	}()
+
+	s := NewState()
+	context := s.newContext()
+	if err := node.(evalNode).visit(&s, &context); err != nil {
+		return nil
+	}
+
+	values = []string{}
+	for x := range context.resultIter() {
+		values = append(values, w.state.fold(x.(string)))
+	}
+	sort.Strings(values)
+	return values
+}
+
+func isStatic(node parserNode) bool {
+	switch n := node.(type) {
+	case nodeText, nodeConstant, nodeNull:
+		return true
+	case nodeOperator:
+		return isStatic(n.left) && isStatic(n.right)
+	case nodeBraces:
+		return isStatic(n.left) && isStatic(n.node) && isStatic(n.right)
+	}
+	return false
+}
+
+// AffectedKeys returns the keys whose values may change as a result of the
+// given changes, such as those returned by Diff, including the changed keys
+// themselves. It follows references found by parsing the state's values, so
+// it is conservative: a key is included if it could be affected, even if
+// evaluating it would give the same result as before.
+func (state *State) AffectedKeys(changes []ClusterDiff) ([]ClusterDiff, error) {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	refs, err := state.references(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := map[string]map[string]bool{}
+	pending := [][2]string{}
+	mark := func(cluster string, key string) {
+		if affected[cluster] == nil {
+			affected[cluster] = map[string]bool{}
+		}
+		if !affected[cluster][key] {
+			affected[cluster][key] = true
+			pending = append(pending, [2]string{cluster, key})
+		}
+	}
+
+	for _, change := range changes {
+		cluster := state.fold(change.Cluster)
+		if len(change.Keys) == 0 {
+			// The cluster was added or removed.
+			mark(cluster, "")
+		}
+		for _, key := range change.Keys {
+			mark(cluster, state.fold(key))
+		}
+	}
+
+	for len(pending) > 0 {
+		changed := pending[0]
+		pending = pending[1:]
+		for _, ref := range refs {
+			if ref.refersTo(changed[0], changed[1]) {
+				mark(ref.Cluster, ref.Key)
+			}
+		}
+	}
+
+	result := []ClusterDiff{}
+	for cluster, keys := range affected {
+		diff := ClusterDiff{cluster, []string{}}
+		for key := range keys {
+			if key != "" {
+				diff.Keys = append(diff.Keys, key)
+			}
+		}
+		sort.Strings(diff.Keys)
+		result = append(result, diff)
+	}
+	sort.Sort(clusterDiffs(result))
+	return result, nil
+}
+
+type references []Reference
+
+func (r references) Len() int      { return len(r) }
+func (r references) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r references) Less(i, j int) bool {
+	a, b := r[i], r[j]
+	if a.Cluster != b.Cluster {
+		return a.Cluster < b.Cluster
+	}
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	if a.Value != b.Value {
+		return a.Value < b.Value
+	}
+	if a.Target != b.Target {
+		return a.Target < b.Target
+	}
+	if a.TargetKey != b.TargetKey {
+		return a.TargetKey < b.TargetKey
+	}
+	return a.Kind < b.Kind
+}
+
+// referencingClusters implements refs(NAME) and deps(NAME), optionally with a
+// second parameter restricting the keys of NAME. refs returns the other
+// clusters whose values refer to NAME, and deps the clusters NAME's values
+// refer to.
+func (n nodeFunction) referencingClusters(state *State, context *evalContext) error {
+	namesContext := context.sub()
+	if err := n.params[0].(evalNode).visit(state, &namesContext); err != nil {
+		return err
+	}
+
+	keys := NewResult()
+	if len(n.params) == 2 {
+		keysContext := context.sub()
+		if err := n.params[1].(evalNode).visit(state, &keysContext); err != nil {
+			return err
+		}
+		keys = keysContext.currentResult
+	}
+
+	refs, err := state.references(context)
+	if err != nil {
+		return err
+	}
+
+	for x := range namesContext.resultIter() {
+		name := state.fold(x.(string))
+		context.charge(costNode, len(refs))
+		for _, ref := range refs {
+			cluster, key, other := ref.Target, ref.TargetKey, ref.Cluster
+			if n.name == "deps" {
+				cluster, key, other = ref.Cluster, ref.Key, ref.Target
+			}
+
+			matches := cluster == name && other != name && other != ""
+			if matches && keys.Cardinality() > 0 {
+				matches = key == "" || key == "KEYS" || keys.Contains(key)
+			}
+			if matches {
+				context.addResult(other)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package grange
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffectedKeys(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a":      Cluster{"CLUSTER": []string{"x"}, "DOWN": []string{"y"}},
+		"b":      Cluster{"CLUSTER": []string{"%a - %a:DOWN"}, "ALL": []string{"$CLUSTER"}},
+		"c":      Cluster{"CLUSTER": []string{"%{b,d}:ALL"}, "OTHER": []string{"z"}},
+		"d":      Cluster{"CLUSTER": []string{"has(TYPE;redis)"}, "TYPE": []string{"redis"}},
+		"e":      Cluster{"CLUSTER": []string{"%{%d}:DOWN"}},
+		"GROUPS": Cluster{"web": []string{"@db"}, "db": []string{"%d"}},
+	})
+
+	tests := []struct {
+		changes  []ClusterDiff
+		expected []ClusterDiff
+	}{
+		{
+			[]ClusterDiff{{"a", []string{"DOWN"}}},
+			[]ClusterDiff{
+				{"a", []string{"DOWN"}},
+				{"b", []string{"ALL", "CLUSTER"}},
+				{"c", []string{"CLUSTER"}},
+				{"e", []string{"CLUSTER"}},
+			},
+		},
+		{
+			[]ClusterDiff{{"a", []string{"OTHER"}}},
+			[]ClusterDiff{{"a", []string{"OTHER"}}},
+		},
+		{
+			// Every cluster's TYPE is used by has(), and any key of d by e.
+			[]ClusterDiff{{"x", []string{"TYPE"}}},
+			[]ClusterDiff{
+				{"GROUPS", []string{"db", "web"}},
+				{"d", []string{"CLUSTER"}},
+				{"e", []string{"CLUSTER"}},
+				{"x", []string{"TYPE"}},
+			},
+		},
+		{
+			// A new cluster could have a TYPE.
+			[]ClusterDiff{{"f", []string{}}},
+			[]ClusterDiff{
+				{"GROUPS", []string{"db", "web"}},
+				{"d", []string{"CLUSTER"}},
+				{"e", []string{"CLUSTER"}},
+				{"f", []string{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		affected, err := state.AffectedKeys(test.changes)
+		if err != nil {
+			t.Errorf("AffectedKeys(%v) returned error: %s", test.changes, err)
+		} else if !reflect.DeepEqual(affected, test.expected) {
+			t.Errorf("AffectedKeys(%v)\n got: %v\nwant: %v", test.changes, affected, test.expected)
+		}
+	}
+}
+
+func TestReferencesTo(t *testing.T) {
+	state := referenceState()
+
+	tests := []struct {
+		cluster  string
+		key      string
+		expected []Reference
+	}{
+		{"a", "", []Reference{
+			{"b", "ALL", "!%a", "%", "a", "CLUSTER"},
+			{"b", "CLUSTER", "%a - %a:DOWN", "%", "a", "CLUSTER"},
+			{"b", "CLUSTER", "%a - %a:DOWN", "%", "a", "DOWN"},
+		}},
+		{"a", "DOWN", []Reference{
+			{"b", "CLUSTER", "%a - %a:DOWN", "%", "a", "DOWN"},
+		}},
+		{"b", "ALL", []Reference{
+			{"b", "CLUSTER", "$ALL", "$", "b", "ALL"},
+		}},
+		{"GROUPS", "", []Reference{
+			{"GROUPS", "web", "?x", "?", "GROUPS", ""},
+			{"GROUPS", "web", "@db", "@", "GROUPS", "db"},
+			{"b", "ALL", "!%a", "!", "GROUPS", ""},
+			{"b", "ALL", "/b/", "/", "GROUPS", ""},
+		}},
+		{"GROUPS", "db", []Reference{
+			{"GROUPS", "web", "?x", "?", "GROUPS", ""},
+			{"GROUPS", "web", "@db", "@", "GROUPS", "db"},
+			{"b", "ALL", "!%a", "!", "GROUPS", ""},
+			{"b", "ALL", "/b/", "/", "GROUPS", ""},
+		}},
+		{"d", "", []Reference{}},
+	}
+
+	for _, test := range tests {
+		refs, err := state.ReferencesTo(test.cluster, test.key)
+		if err != nil {
+			t.Errorf("ReferencesTo(%s, %s) returned error: %s", test.cluster, test.key, err)
+		} else if !reflect.DeepEqual(refs, test.expected) {
+			t.Errorf("ReferencesTo(%s, %s)\n got: %v\nwant: %v", test.cluster, test.key, refs, test.expected)
+		}
+	}
+}
+
+// References to the default cluster follow SetDefaultCluster and
+// SetUniverseKey.
+func TestReferencesToDefaultCluster(t *testing.T) {
+	state := singleCluster("a", Cluster{"CLUSTER": []string{"?x", "!y"}})
+
+	tests := []struct {
+		change   func()
+		cluster  string
+		key      string
+		expected []Reference
+	}{
+		{func() {}, "GROUPS", "", []Reference{
+			{"a", "CLUSTER", "!y", "!", "GROUPS", ""},
+			{"a", "CLUSTER", "?x", "?", "GROUPS", ""},
+		}},
+		{func() { state.SetDefaultCluster("OTHER") }, "GROUPS", "", []Reference{}},
+		{func() {}, "OTHER", "", []Reference{
+			{"a", "CLUSTER", "!y", "!", "OTHER", ""},
+			{"a", "CLUSTER", "?x", "?", "OTHER", ""},
+		}},
+		{func() { state.SetUniverseKey("ALL") }, "OTHER", "DOWN", []Reference{
+			{"a", "CLUSTER", "?x", "?", "OTHER", ""},
+		}},
+		{func() {}, "OTHER", "ALL", []Reference{
+			{"a", "CLUSTER", "!y", "!", "OTHER", "ALL"},
+			{"a", "CLUSTER", "?x", "?", "OTHER", ""},
+		}},
+	}
+
+	for _, test := range tests {
+		test.change()
+		refs, err := state.ReferencesTo(test.cluster, test.key)
+		if err != nil {
+			t.Errorf("ReferencesTo(%s, %s) returned error: %s", test.cluster, test.key, err)
+		} else if !reflect.DeepEqual(refs, test.expected) {
+			t.Errorf("ReferencesTo(%s, %s)\n got: %v\nwant: %v", test.cluster, test.key, refs, test.expected)
+		}
+	}
+}
+
+func TestDependenciesOf(t *testing.T) {
+	state := referenceState()
+
+	tests := []struct {
+		cluster  string
+		key      string
+		expected []Reference
+	}{
+		{"c", "", []Reference{
+			{"c", "CLUSTER", "%{%b}:{X,Y}", "%", "", "X"},
+			{"c", "CLUSTER", "%{%b}:{X,Y}", "%", "", "Y"},
+			{"c", "CLUSTER", "%{%b}:{X,Y}", "%", "b", "CLUSTER"},
+			{"c", "CLUSTER", "has(TYPE;/redis/) & /c/", "has()", "", "TYPE"},
+		}},
+		{"GROUPS", "db", []Reference{
+			{"GROUPS", "db", "*x", "clusters()", "", "CLUSTER"},
+		}},
+		{"b", "nope", []Reference{}},
+	}
+
+	for _, test := range tests {
+		refs, err := state.DependenciesOf(test.cluster, test.key)
+		if err != nil {
+			t.Errorf("DependenciesOf(%s, %s) returned error: %s", test.cluster, test.key, err)
+		} else if !reflect.DeepEqual(refs, test.expected) {
+			t.Errorf("DependenciesOf(%s, %s)\n got: %v\nwant: %v", test.cluster, test.key, refs, test.expected)
+		}
+	}
+}
+
+// Values are only parsed for references once per change to the state, and
+// the keys parsed are charged as lookups.
+func TestReferenceIndexCost(t *testing.T) {
+	state := multiCluster(map[string]Cluster{
+		"a": Cluster{"CLUSTER": []string{"x"}, "DOWN": []string{"y"}},
+		"b": Cluster{"CLUSTER": []string{"%a"}},
+	})
+
+	tests := []struct {
+		query    string
+		expected Result
+		lookups  int
+	}{
+		{"refs(a)", NewResult("b"), 3},
+		{"refs(a)", NewResult("b"), 0},
+		{"deps(b)", NewResult("a"), 0},
+	}
+	for _, test := range tests {
+		result, cost, err := state.QueryCost(test.query, 0)
+		if err != nil || !result.Equal(test.expected.Set) || cost.Lookups != test.lookups {
+			t.Errorf("QueryCost(%s) = %v, %+v, %v, expected %v with %d lookups",
+				test.query, result, cost, err, test.expected, test.lookups)
+		}
+	}
+
+	state.AddCluster("c", Cluster{"CLUSTER": []string{"%a:DOWN"}})
+	result, cost, err := state.QueryCost("refs(a)", 0)
+	if err != nil || !result.Equal(NewResult("b", "c").Set) || cost.Lookups != 4 {
+		t.Errorf("QueryCost(refs(a)) after change = %v, %+v, %v", result, cost, err)
+	}
+}
@@ -0,0 +1,121 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vbom.ml/util/sortorder"
+)
+
+// Handler serves queries over HTTP using the same protocol as libcrange's
+// mod_ranged, so existing range clients can use it unchanged:
+//
+//	GET /range/list?%dc1    - one value per line, naturally sorted.
+//	GET /range/expand?%dc1  - the result compressed, as by Compress.
+//
+// The query is the URL-encoded raw query string. Errors are returned in the
+// RangeException header with an empty body. The total cost of evaluating the
+// query, as returned by QueryCost, is returned in the RangeCost header, and
+// queries over MaxQueryCost are aborted.
+//
+// Handler is safe for concurrent use. The state can be replaced at any time
+// with SetState, in-flight requests finish against the state they started
+// with.
+type Handler struct {
+	mutex sync.RWMutex
+	state *State
+}
+
+// NewHandler returns a handler serving queries against state. See SetState.
+func NewHandler(state *State) (*Handler, []error) {
+	h := &Handler{}
+	return h, h.SetState(state)
+}
+
+// SetState replaces the state queries are served from. The state's cache is
+// primed first, since queries are only thread-safe on a primed state, and any
+// errors from doing so are returned. Clusters may still be changed with
+// AddCluster, RemoveCluster and Reload, such as by WatchDir, since they keep
+// the cache primed. Other changes, such as SetCaseInsensitive, discard the
+// cache, so build a new state and call SetState again instead.
+func (h *Handler) SetState(state *State) []error {
+	errs := state.PrimeCache()
+
+	h.mutex.Lock()
+	h.state = state
+	h.mutex.Unlock()
+
+	return errs
+}
+
+func (h *Handler) currentState() *State {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.state
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var format func(*Result) (string, error)
+
+	switch r.URL.Path {
+	case "/range/list":
+		format = formatList
+	case "/range/expand":
+		format = Compress
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := url.QueryUnescape(r.URL.RawQuery)
+	if err != nil {
+		rangeException(w, errors.New(fmt.Sprintf("Invalid query encoding: %s", r.URL.RawQuery)))
+		return
+	}
+
+	result, cost, err := h.currentState().QueryCost(query, 0)
+	w.Header().Set("RangeCost", strconv.Itoa(cost.Total()))
+	if err != nil {
+		rangeException(w, err)
+		return
+	}
+
+	body, err := format(&result)
+	if err != nil {
+		rangeException(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, body)
+}
+
+func rangeException(w http.ResponseWriter, err error) {
+	w.Header().Set("RangeException", err.Error())
+	w.WriteHeader(http.StatusOK)
+}
+
+func formatList(result *Result) (string, error) {
+	values := []string{}
+	for value := range result.Iter() {
+		values = append(values, value.(string))
+	}
+	sort.Sort(sortorder.Natural(values))
+
+	if len(values) == 0 {
+		return "", nil
+	}
+	return strings.Join(values, "\n") + "\n", nil
+}
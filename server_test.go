@@ -0,0 +1,58 @@
+package grange
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func testRequest(t *testing.T, h http.Handler, method string, path string, code int, body string, exception string) {
+	r := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	actual, _ := ioutil.ReadAll(w.Result().Body)
+	if w.Code != code {
+		t.Errorf("%s %s returned %d, want %d", method, path, w.Code, code)
+	}
+	if string(actual) != body {
+		t.Errorf("%s %s\n got: %q\nwant: %q", method, path, actual, body)
+	}
+	if header := w.Header().Get("RangeException"); header != exception {
+		t.Errorf("%s %s RangeException\n got: %s\nwant: %s", method, path, header, exception)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	state := singleCluster("dc1", Cluster{
+		"CLUSTER": []string{"web10", "web2", "web1"},
+		"BAD":     []string{"%dc1 -"},
+	})
+	h, errs := NewHandler(state)
+	if len(errs) != 1 {
+		t.Errorf("Expected one priming error, got: %v", errs)
+	}
+
+	testRequest(t, h, "GET", "/range/list?%25dc1", 200, "web1\nweb2\nweb10\n", "")
+	testRequest(t, h, "GET", "/range/list?"+url.QueryEscape("%dc1 - web2"), 200, "web1\nweb10\n", "")
+	testRequest(t, h, "GET", "/range/list?", 200, "", "")
+	testRequest(t, h, "GET", "/range/expand?%25dc1", 200, "web1..2,web10", "")
+	testRequest(t, h, "GET", "/range/expand?a,b", 200, "a,b", "")
+
+	testRequest(t, h, "GET", "/range/list?a,", 200, "", "Could not parse query: a,")
+	testRequest(t, h, "GET", "/range/expand?%25dc1:BAD", 200, "", "Could not parse query: %dc1 -")
+	testRequest(t, h, "GET", "/range/list?%zz", 200, "", "Invalid query encoding: %zz")
+
+	testRequest(t, h, "GET", "/range/other?a", 404, "404 page not found\n", "")
+	testRequest(t, h, "POST", "/range/list?a", 405, "Method not allowed\n", "")
+}
+
+func TestHandlerSetState(t *testing.T) {
+	h, _ := NewHandler(singleCluster("dc1", Cluster{"CLUSTER": []string{"a"}}))
+	testRequest(t, h, "GET", "/range/list?%25dc1", 200, "a\n", "")
+
+	h.SetState(singleCluster("dc1", Cluster{"CLUSTER": []string{"b"}}))
+	testRequest(t, h, "GET", "/range/list?%25dc1", 200, "b\n", "")
+}
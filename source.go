@@ -0,0 +1,279 @@
+package grange
+
+import (
+	"sort"
+	"sync"
+)
+
+// A ClusterSource provides clusters to a state on demand, so that a large
+// store does not need to be loaded up front with AddCluster. See SetSource.
+//
+// Sources must be safe for concurrent use.
+type ClusterSource interface {
+	// Get returns the named cluster, or nil if the source does not have it.
+	Get(name string) (Cluster, error)
+
+	// List returns the names of every cluster in the source.
+	List() ([]string, error)
+
+	// Watch returns a channel that receives the name of each cluster that is
+	// added, changed or removed, or nil if the source cannot detect changes.
+	// Changes to the same cluster may be coalesced.
+	Watch() <-chan string
+}
+
+// SetSource sets where clusters that have not been added with AddCluster are
+// loaded from. Clusters are loaded the first time a query refers to them,
+// and functions such as allclusters() load every cluster in the source.
+//
+// Once loaded, a cluster does not change until Reload is called for it, so
+// that queries remain deterministic even while the source changes. The same
+// is true of clusters the source does not have.
+func (state *State) SetSource(source ClusterSource) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for name := range state.loaded {
+		delete(state.clusters, name)
+	}
+	state.source = source
+	state.loaded = map[string]bool{}
+	state.missing = map[string]bool{}
+	state.listed = false
+	state.ResetCache()
+}
+
+// Reload forgets what was loaded from the source for the named cluster, so
+// that the next query that refers to it loads it again. It is typically
+// called with names received from the source's Watch channel. Like
+// AddCluster, only cached values that used the cluster are discarded.
+func (state *State) Reload(name string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	name = state.fold(name)
+	if state.loaded[name] {
+		delete(state.clusters, name)
+		delete(state.loaded, name)
+	}
+	delete(state.missing, name)
+	state.listed = false
+	state.update(name)
+	state.memo.reset()
+}
+
+// cluster returns the cluster with the given folded name, loading it from
+// the source if it has not been seen before.
+func (state *State) cluster(name string) (Cluster, error) {
+	state.recordCluster(name)
+
+	state.sourceMutex.Lock()
+	defer state.sourceMutex.Unlock()
+
+	if c, ok := state.clusters[name]; ok || state.source == nil || state.missing[name] {
+		return c, nil
+	}
+
+	c, err := state.source.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil && state.caseInsensitive && !state.listed {
+		// The source may have the cluster with different case.
+		if err := state.loadAll(); err != nil {
+			return nil, err
+		}
+		if c, ok := state.clusters[name]; ok {
+			return c, nil
+		}
+	}
+
+	state.load(name, c)
+	return state.clusters[name], nil
+}
+
+// allClusters loads every cluster from the source, for functions that need
+// to look at all of them. With a source, the clusters are copied, since
+// concurrent queries may load more while they are being looked at.
+func (state *State) allClusters() (map[string]Cluster, error) {
+	state.recordAll()
+	if state.source == nil {
+		return state.clusters, nil
+	}
+
+	state.sourceMutex.Lock()
+	defer state.sourceMutex.Unlock()
+
+	if err := state.loadAll(); err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]Cluster, len(state.clusters))
+	for name, c := range state.clusters {
+		clusters[name] = c
+	}
+	return clusters, nil
+}
+
+func (state *State) loadAll() error {
+	if state.source == nil || state.listed {
+		return nil
+	}
+
+	names, err := state.source.List()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, ok := state.clusters[state.fold(name)]; ok {
+			continue
+		}
+
+		c, err := state.source.Get(name)
+		if err != nil {
+			return err
+		}
+		state.load(name, c)
+	}
+	state.listed = true
+	return nil
+}
+
+func (state *State) load(name string, c Cluster) {
+	name = state.fold(name)
+	if c == nil {
+		state.missing[name] = true
+		return
+	}
+
+	if state.caseInsensitive {
+		c = c.fold()
+	}
+	state.clusters[name] = c
+	state.loaded[name] = true
+	delete(state.missing, name)
+}
+
+// MemorySource is a ClusterSource backed by a map, mostly useful for tests
+// and for sources that are cheap to load in full.
+type MemorySource struct {
+	mutex    sync.RWMutex
+	clusters map[string]Cluster
+	watchers watchers
+}
+
+// NewMemorySource returns an empty MemorySource.
+func NewMemorySource() *MemorySource {
+	return &MemorySource{clusters: map[string]Cluster{}}
+}
+
+// Set adds or replaces a cluster. The cluster must not be modified
+// afterwards.
+func (s *MemorySource) Set(name string, c Cluster) {
+	s.mutex.Lock()
+	s.clusters[name] = c
+	s.mutex.Unlock()
+
+	s.watchers.notify(name)
+}
+
+// Delete removes a cluster.
+func (s *MemorySource) Delete(name string) {
+	s.mutex.Lock()
+	delete(s.clusters, name)
+	s.mutex.Unlock()
+
+	s.watchers.notify(name)
+}
+
+func (s *MemorySource) Get(name string) (Cluster, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.clusters[name], nil
+}
+
+func (s *MemorySource) List() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := []string{}
+	for name := range s.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemorySource) Watch() <-chan string {
+	return s.watchers.add()
+}
+
+// watchers fans change notifications out to Watch channels. Each channel is
+// fed by its own goroutine so that a slow reader does not block changes, and
+// names that are already pending are not queued twice, so memory use is
+// bounded by the number of clusters.
+type watchers struct {
+	mutex sync.Mutex
+	list  []*watcher
+}
+
+type watcher struct {
+	mutex   sync.Mutex
+	pending []string
+	queued  map[string]bool
+	wake    chan struct{}
+	out     chan string
+}
+
+func (w *watchers) add() <-chan string {
+	watcher := &watcher{
+		queued: map[string]bool{},
+		wake:   make(chan struct{}, 1),
+		out:    make(chan string),
+	}
+	go watcher.run()
+
+	w.mutex.Lock()
+	w.list = append(w.list, watcher)
+	w.mutex.Unlock()
+
+	return watcher.out
+}
+
+func (w *watchers) notify(name string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, watcher := range w.list {
+		watcher.mutex.Lock()
+		if !watcher.queued[name] {
+			watcher.queued[name] = true
+			watcher.pending = append(watcher.pending, name)
+		}
+		watcher.mutex.Unlock()
+
+		select {
+		case watcher.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *watcher) run() {
+	for range w.wake {
+		for {
+			w.mutex.Lock()
+			if len(w.pending) == 0 {
+				w.mutex.Unlock()
+				break
+			}
+			name := w.pending[0]
+			w.pending = w.pending[1:]
+			delete(w.queued, name)
+			w.mutex.Unlock()
+
+			w.out <- name
+		}
+	}
+}
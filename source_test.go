@@ -0,0 +1,179 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sourceState(source ClusterSource) *State {
+	state := NewState()
+	state.SetSource(source)
+	return &state
+}
+
+func TestSourceLazyLoading(t *testing.T) {
+	source := NewMemorySource()
+	source.Set("a", Cluster{"CLUSTER": []string{"%b", "x"}})
+	source.Set("b", Cluster{"CLUSTER": []string{"y"}})
+	source.Set("c", Cluster{"CLUSTER": []string{"z"}, "TYPE": []string{"db"}})
+	state := sourceState(source)
+
+	testEval(t, NewResult("x", "y"), "%a", state)
+	if len(state.Clusters()) != 2 {
+		t.Errorf("Expected only a and b to be loaded, got: %v", state.Clusters())
+	}
+
+	testEval(t, NewResult("a", "b", "c"), "allclusters()", state)
+	testEval(t, NewResult("c"), "has(TYPE;db)", state)
+	testEval(t, NewResult("a", "b"), "clusters(y)", state)
+	testEval(t, NewResult(), "%missing", state)
+}
+
+func TestSourceAddClusterTakesPrecedence(t *testing.T) {
+	source := NewMemorySource()
+	source.Set("a", Cluster{"CLUSTER": []string{"x"}})
+	state := sourceState(source)
+
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"y"}})
+	testEval(t, NewResult("y"), "%a", state)
+
+	state.Reload("a")
+	testEval(t, NewResult("y"), "%a", state)
+}
+
+func TestSourceDeterminism(t *testing.T) {
+	source := NewMemorySource()
+	source.Set("a", Cluster{"CLUSTER": []string{"x"}})
+	state := sourceState(source)
+
+	testEval(t, NewResult("x"), "%a", state)
+	testEval(t, NewResult(), "%b", state)
+
+	source.Set("a", Cluster{"CLUSTER": []string{"y"}})
+	source.Set("b", Cluster{"CLUSTER": []string{"z"}})
+	testEval(t, NewResult("x"), "%a", state)
+	testEval(t, NewResult(), "%b", state)
+
+	state.Reload("a")
+	state.Reload("b")
+	testEval(t, NewResult("y"), "%a", state)
+	testEval(t, NewResult("z"), "%b", state)
+
+	source.Delete("a")
+	state.Reload("a")
+	testEval(t, NewResult(), "%a", state)
+	testEval(t, NewResult("b"), "allclusters()", state)
+}
+
+func TestSourceWatch(t *testing.T) {
+	source := NewMemorySource()
+	changes := source.Watch()
+
+	source.Set("a", Cluster{})
+	source.Set("b", Cluster{})
+	source.Delete("a")
+
+	received := map[string]bool{}
+	for len(received) < 2 {
+		select {
+		case name := <-changes:
+			received[name] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for changes, got: %v", received)
+		}
+	}
+	if !received["a"] || !received["b"] {
+		t.Errorf("Expected changes to a and b, got: %v", received)
+	}
+}
+
+func TestSourceCaseInsensitive(t *testing.T) {
+	source := NewMemorySource()
+	source.Set("DC1", Cluster{"CLUSTER": []string{"WEB1"}, "Down": []string{"web1"}})
+	state := sourceState(source)
+	state.SetCaseInsensitive(true)
+
+	testEval(t, NewResult("web1"), "%dc1", state)
+	testEval(t, NewResult("web1"), "%DC1:DOWN", state)
+}
+
+// Run with -race: queries load clusters from the source while holding the
+// state's lock only for reading.
+func TestSourceConcurrentQueries(t *testing.T) {
+	source := NewMemorySource()
+	source.Set("a", Cluster{"CLUSTER": []string{"x"}, "TYPE": []string{"db"}})
+	source.Set("b", Cluster{"CLUSTER": []string{"y"}})
+	state := sourceState(source)
+	state.PrimeCache()
+
+	source.Set("c", Cluster{"CLUSTER": []string{"z"}})
+	state.Reload("c")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				testEval(t, NewResult(), fmt.Sprintf("%%unknown%d_%d", i, j), state)
+				testEval(t, NewResult("a"), "has(TYPE;db)", state)
+				testEval(t, NewResult("a", "b", "c"), "allclusters()", state)
+				testEval(t, NewResult("x", "z"), "%a,%c", state)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+type failingSource struct{}
+
+func (s failingSource) Get(name string) (Cluster, error) { return nil, errors.New("unavailable") }
+func (s failingSource) List() ([]string, error)          { return nil, errors.New("unavailable") }
+func (s failingSource) Watch() <-chan string             { return nil }
+
+func TestSourceErrors(t *testing.T) {
+	state := sourceState(failingSource{})
+
+	testError2(t, "unavailable", "%a", state)
+	testError2(t, "unavailable", "allclusters()", state)
+	testError2(t, "unavailable", "has(A;b)", state)
+
+	if errs := state.PrimeCache(); len(errs) != 1 {
+		t.Errorf("Expected one error from PrimeCache, got: %v", errs)
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte("CLUSTER: [x]"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"CLUSTER": ["y"]}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("CLUSTER: [z]"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bad.yml"), []byte("CLUSTER: [z"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden.yaml"), []byte("CLUSTER: [h]"), 0644)
+
+	source := NewDirSource(dir)
+	names, err := source.List()
+	if err != nil || len(names) != 3 {
+		t.Errorf("List() = %v, %v", names, err)
+	}
+
+	state := sourceState(source)
+	testEval(t, NewResult("x", "y"), "%a,%b", state)
+	testEval(t, NewResult(), "%c", state)
+	testEval(t, NewResult(), "%.hidden", state)
+	testEval(t, NewResult(), `%"../`+filepath.Base(dir)+`/a"`, state)
+	if _, err := state.Query("%bad"); err == nil {
+		t.Errorf("Expected error for invalid cluster file")
+	}
+}
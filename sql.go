@@ -0,0 +1,82 @@
+package grange
+
+import (
+	"database/sql"
+)
+
+// SQLiteSchema creates the table read by SQLiteSource. Each value of a key is
+// a row, and a key with no values is a single row with a NULL value.
+const SQLiteSchema = `CREATE TABLE IF NOT EXISTS clusters (
+	cluster TEXT NOT NULL,
+	key     TEXT NOT NULL,
+	value   TEXT
+);
+CREATE INDEX IF NOT EXISTS clusters_cluster ON clusters (cluster);`
+
+// SQLiteSource is a ClusterSource that reads clusters from a SQLite file with
+// the table in SQLiteSchema. It uses database/sql, so grange does not depend
+// on any particular driver: open the file with whichever driver you already
+// use.
+//
+//	db, err := sql.Open("sqlite3", "clusters.db")
+//	state.SetSource(grange.NewSQLiteSource(db))
+type SQLiteSource struct {
+	db *sql.DB
+}
+
+// NewSQLiteSource returns a source reading from db.
+func NewSQLiteSource(db *sql.DB) *SQLiteSource {
+	return &SQLiteSource{db}
+}
+
+func (s *SQLiteSource) Get(name string) (Cluster, error) {
+	rows, err := s.db.Query(
+		"SELECT key, value FROM clusters WHERE cluster = ? ORDER BY rowid", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var c Cluster
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			c = Cluster{}
+		}
+		if _, ok := c[key]; !ok {
+			c[key] = []string{}
+		}
+		if value.Valid {
+			c[key] = append(c[key], value.String)
+		}
+	}
+	return c, rows.Err()
+}
+
+func (s *SQLiteSource) List() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT cluster FROM clusters ORDER BY cluster")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Watch returns nil, SQLiteSource does not detect changes.
+func (s *SQLiteSource) Watch() <-chan string {
+	return nil
+}
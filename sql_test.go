@@ -0,0 +1,108 @@
+package grange
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// A fake driver that understands just the queries SQLiteSource makes, so it
+// can be tested without depending on a real SQLite driver.
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct {
+	query string
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+var fakeTable = [][]driver.Value{
+	{"a", "CLUSTER", "x"},
+	{"a", "CLUSTER", "y"},
+	{"a", "EMPTY", nil},
+	{"b", "CLUSTER", "%a"},
+}
+
+func init() {
+	sql.Register("grangetest", fakeDriver{})
+}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return strings.Count(s.query, "?") }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(s.query, "SELECT key, value FROM clusters WHERE cluster = ?"):
+		result := &fakeRows{columns: []string{"key", "value"}}
+		for _, row := range fakeTable {
+			if row[0] == args[0] {
+				result.rows = append(result.rows, row[1:])
+			}
+		}
+		return result, nil
+	case strings.HasPrefix(s.query, "SELECT DISTINCT cluster FROM clusters"):
+		seen := map[string]bool{}
+		names := []string{}
+		for _, row := range fakeTable {
+			if name := row[0].(string); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		result := &fakeRows{columns: []string{"cluster"}}
+		for _, name := range names {
+			result.rows = append(result.rows, []driver.Value{name})
+		}
+		return result, nil
+	}
+	return nil, errors.New("unexpected query: " + s.query)
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLiteSource(t *testing.T) {
+	db, err := sql.Open("grangetest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	source := NewSQLiteSource(db)
+	state := sourceState(source)
+
+	testEval(t, NewResult("x", "y"), "%a", state)
+	testEval(t, NewResult("x", "y"), "%b", state)
+	testEval(t, NewResult("CLUSTER", "EMPTY"), "%a:KEYS", state)
+	testEval(t, NewResult(), "%a:EMPTY", state)
+	testEval(t, NewResult("a", "b"), "allclusters()", state)
+	testEval(t, NewResult(), "%c", state)
+}
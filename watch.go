@@ -0,0 +1,161 @@
+package grange
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DirPollInterval is how often a DirWatcher checks its directory for changes.
+var DirPollInterval = 2 * time.Second
+
+// DirWatcher keeps a state up to date with a directory of cluster files, in
+// the same format as LoadDir. See WatchDir.
+type DirWatcher struct {
+	dir     string
+	state   *State
+	onError func(error)
+
+	mutex sync.Mutex
+	files map[string]fileVersion
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// The cluster a file defines and a hash of its contents when it was last
+// loaded, used to tell when it has changed. Modification times are not used,
+// since they may be too coarse to tell apart quick rewrites of the same size.
+type fileVersion struct {
+	name string
+	sum  [sha256.Size]byte
+}
+
+// WatchDir loads the clusters in dir into state, then polls the directory
+// every DirPollInterval to add, replace and remove clusters as their files
+// change. Polling is used rather than inotify so that changes made by tools
+// that replace whole directories, such as a git checkout, are not missed.
+// Files are compared by their contents, so each poll reads every file.
+//
+// Each change only discards cached values that used the changed cluster, and
+// a primed state stays primed, so the state can be queried while it is being
+// watched.
+//
+// If a file cannot be loaded, the error is passed to onError, which may be
+// nil, and the last version of the cluster that loaded is kept until the file
+// changes again.
+func WatchDir(dir string, state *State, onError func(error)) *DirWatcher {
+	w := &DirWatcher{
+		dir:     dir,
+		state:   state,
+		onError: onError,
+		files:   map[string]fileVersion{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.Poll()
+	go w.run()
+	return w
+}
+
+func (w *DirWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(DirPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Poll()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop stops polling. The state is left as it was after the last poll.
+func (w *DirWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Poll checks the directory for changes immediately, rather than waiting for
+// the next interval.
+func (w *DirWatcher) Poll() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(w.dir, "*"))
+	if err != nil {
+		w.report(err)
+		return
+	}
+
+	// Several files may define the same cluster, such as a.yaml and a.json,
+	// so a cluster is only removed once none of them are left.
+	current := map[string]string{}
+	names := map[string]bool{}
+	for _, path := range paths {
+		if isClusterFile(path) {
+			current[path] = clusterFileName(path)
+			names[current[path]] = true
+		}
+	}
+
+	for path, version := range w.files {
+		if _, ok := current[path]; ok {
+			continue
+		}
+		delete(w.files, path)
+
+		if !names[version.name] {
+			w.state.RemoveCluster(version.name)
+			continue
+		}
+		// Load the remaining files again, in case the removed one was the
+		// last to be added.
+		for other, name := range current {
+			if name == version.name {
+				delete(w.files, other)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		name, ok := current[path]
+		if !ok {
+			continue
+		}
+
+		dat, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Removed since the glob, handled on the next poll.
+			continue
+		} else if err != nil {
+			w.report(err)
+			continue
+		}
+
+		version := fileVersion{name, sha256.Sum256(dat)}
+		if previous, ok := w.files[path]; ok && previous == version {
+			continue
+		}
+		w.files[path] = version
+
+		_, c, err := parseClusterFile(path, dat)
+		if err != nil {
+			w.report(err)
+			continue
+		}
+		w.state.AddCluster(name, c)
+	}
+}
+
+func (w *DirWatcher) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
@@ -0,0 +1,203 @@
+package grange
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeCluster(t *testing.T, path string, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [x]\n")
+	writeCluster(t, filepath.Join(dir, "b.txt"), "ignored")
+
+	errs := []error{}
+	state := NewState()
+	watcher := WatchDir(dir, &state, func(err error) { errs = append(errs, err) })
+	defer watcher.Stop()
+
+	testEval(t, NewResult("x"), "%a", &state)
+	testEval(t, NewResult("a"), "allclusters()", &state)
+
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [x, w]\n")
+	writeCluster(t, filepath.Join(dir, "c.json"), `{"CLUSTER": ["%a"]}`)
+	watcher.Poll()
+	testEval(t, NewResult("x", "w"), "%a", &state)
+	testEval(t, NewResult("x", "w"), "%c", &state)
+
+	// The last good version is kept while a file is invalid.
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [z\n")
+	watcher.Poll()
+	watcher.Poll()
+	testEval(t, NewResult("x", "w"), "%a", &state)
+	if len(errs) != 1 {
+		t.Errorf("Expected one error for invalid cluster file, got %v", errs)
+	}
+
+	os.Remove(filepath.Join(dir, "a.yaml"))
+	watcher.Poll()
+	testEval(t, NewResult(), "%c", &state)
+	testEval(t, NewResult("c"), "allclusters()", &state)
+}
+
+func TestWatchDirSameSizeRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.yaml")
+	writeCluster(t, path, "CLUSTER: [x]\n")
+	info, _ := os.Stat(path)
+
+	state := NewState()
+	watcher := WatchDir(dir, &state, nil)
+	defer watcher.Stop()
+
+	// As from a checkout within the granularity of modification times.
+	writeCluster(t, path, "CLUSTER: [z]\n")
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	watcher.Poll()
+	testEval(t, NewResult("z"), "%a", &state)
+}
+
+func TestWatchDirSameClusterInSeveralFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCluster(t, filepath.Join(dir, "a.json"), `{"CLUSTER": ["x"]}`)
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [z]\n")
+
+	state := NewState()
+	watcher := WatchDir(dir, &state, nil)
+	defer watcher.Stop()
+	testEval(t, NewResult("z"), "%a", &state)
+
+	os.Remove(filepath.Join(dir, "a.yaml"))
+	watcher.Poll()
+	testEval(t, NewResult("x"), "%a", &state)
+	testEval(t, NewResult("a"), "allclusters()", &state)
+
+	os.Remove(filepath.Join(dir, "a.json"))
+	watcher.Poll()
+	testEval(t, NewResult(), "allclusters()", &state)
+}
+
+// WatchDir loads the same files as LoadDir, so a dotfile is not loaded only
+// to never be refreshed or removed.
+func TestWatchDirIgnoresDotfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [x]\n")
+	writeCluster(t, filepath.Join(dir, ".a.yaml"), "CLUSTER: [y]\n")
+
+	loaded, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewState()
+	watcher := WatchDir(dir, &state, nil)
+	defer watcher.Stop()
+	for _, s := range []*State{&loaded, &state} {
+		testEval(t, NewResult("a"), "allclusters()", s)
+		testEval(t, NewResult("x"), "%a", s)
+	}
+
+	writeCluster(t, filepath.Join(dir, ".b.json"), `{"CLUSTER": ["z"]}`)
+	watcher.Poll()
+	testEval(t, NewResult("a"), "allclusters()", &state)
+}
+
+func TestIncrementalInvalidation(t *testing.T) {
+	state := NewState()
+	state.AddCluster("a", Cluster{"CLUSTER": []string{"%b"}})
+	state.AddCluster("b", Cluster{"CLUSTER": []string{"x"}})
+	state.AddCluster("c", Cluster{"CLUSTER": []string{"y"}})
+	state.AddCluster("d", Cluster{"CLUSTER": []string{"%e"}})
+	state.AddCluster("all", Cluster{"CLUSTER": []string{"allclusters()"}})
+	state.PrimeCache()
+
+	cached := func(name string) bool {
+		return state.clusterCache[name]["CLUSTER"] != nil
+	}
+
+	state.clusterCache["a"]["CLUSTER"].result.Add("stale")
+	state.clusterCache["c"]["CLUSTER"].result.Add("kept")
+	state.AddCluster("b", Cluster{"CLUSTER": []string{"z"}})
+
+	testEval(t, NewResult("z"), "%a", &state)
+	testEval(t, NewResult("y", "kept"), "%c", &state)
+	if !cached("a") || !cached("b") {
+		t.Errorf("Expected changed clusters to be primed again")
+	}
+
+	// Clusters that referred to a missing cluster are updated when it is
+	// added.
+	state.AddCluster("e", Cluster{"CLUSTER": []string{"w"}})
+	testEval(t, NewResult("w"), "%d", &state)
+	testEval(t, NewResult("a", "all", "b", "c", "d", "e"), "%all", &state)
+
+	state.RemoveCluster("b")
+	testEval(t, NewResult(), "%a", &state)
+	testEval(t, NewResult(), "%b", &state)
+	testEval(t, NewResult("a", "all", "c", "d", "e"), "%all", &state)
+}
+
+func TestWatchDirConcurrentQueries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [x]\n")
+	writeCluster(t, filepath.Join(dir, "b.yaml"), "CLUSTER: ['%a']\n")
+
+	state := NewState()
+	watcher := WatchDir(dir, &state, nil)
+	defer watcher.Stop()
+	state.PrimeCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := state.Query("%b"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		writeCluster(t, filepath.Join(dir, "a.yaml"), "CLUSTER: [x"+strings.Repeat("x", i)+"]\n")
+		watcher.Poll()
+	}
+	wg.Wait()
+
+	testEval(t, NewResult("xxxxxxxxxx"), "%b", &state)
+}
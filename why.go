@@ -0,0 +1,332 @@
+package grange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Derivation explains how a value came to be in the result of an
+// expression, or why it is not. See State.Why.
+type Derivation struct {
+	// How the expression is evaluated, such as "union (,)" or "cluster
+	// lookup", and the expression itself.
+	Step string
+	Expr string
+
+	// For values stored in a cluster, the cluster and key they are stored at,
+	// in which case Expr is the value as stored. Otherwise empty.
+	Cluster string
+	Key     string
+
+	// Whether the value is in the result of Expr.
+	Included bool
+
+	// Whether Expr removed the value from the result it is part of, as the
+	// right side of a difference or the inside of a complement.
+	Removed bool
+
+	// The parts of Expr that the value came from, or that removed it.
+	Children []Derivation
+}
+
+// String formats the derivation as an indented tree, such as:
+//
+//	not in: difference (-) %{dc1} - %{down}
+//	  in: cluster lookup %{dc1}
+//	    in: numeric range web1..3 from dc1:CLUSTER
+//	  removed by: cluster lookup %{down}
+//	    in: value web1 from down:CLUSTER
+//
+// Expressions are shown in the canonical form used by Explain, except for
+// values stored in clusters, which are shown as stored.
+func (d Derivation) String() string {
+	lines := []string{}
+	d.format("", &lines)
+	return strings.Join(lines, "\n")
+}
+
+func (d Derivation) format(indent string, lines *[]string) {
+	status := "not in"
+	if d.Removed {
+		status = "removed by"
+	} else if d.Included {
+		status = "in"
+	}
+
+	line := fmt.Sprintf("%s%s: %s %s", indent, status, d.Step, d.Expr)
+	if d.Cluster != "" {
+		line += fmt.Sprintf(" from %s:%s", d.Cluster, d.Key)
+	}
+	*lines = append(*lines, strings.TrimRight(line, " "))
+
+	for _, child := range d.Children {
+		child.format(indent+"  ", lines)
+	}
+}
+
+// Why explains why a value is or is not in the result of a query, by
+// following the parts of the query and the cluster values that contributed
+// it, and any that removed it. Only parts that include the value are
+// followed, except for both sides of differences, intersections and symmetric
+// differences, which are needed to explain exclusions. Of the sides of a
+// union, only the first to include the value is followed, as later ones do not
+// add it to the result.
+func (state *State) Why(input string, value string) (Derivation, error) {
+	if len(input) > MaxQuerySize {
+		return Derivation{},
+			errors.New(fmt.Sprintf("Query is too long, max length is %d", MaxQuerySize))
+	}
+
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+
+	node, err := parseRange(input, state.unicodeIdentifiers)
+	if err != nil {
+		return Derivation{}, err
+	}
+
+	t := &tracer{state, value}
+	context := state.newContext()
+	d, _, err := t.explain(node, &context)
+	return d, err
+}
+
+type tracer struct {
+	state *State
+	value string
+}
+
+// explain evaluates node as it would be in context, and explains the value's
+// presence in the result, which is also returned.
+func (t *tracer) explain(node parserNode, context *evalContext) (Derivation, Result, error) {
+	subContext := context.sub()
+	subContext.workingResult = context.workingResult
+	return t.explainInto(node, context, &subContext)
+}
+
+// explainInto is explain, but evaluates node into target, which may already
+// hold the results of other nodes, as the sides of a union share a context.
+// The value is only included if node added it to target.
+func (t *tracer) explainInto(node parserNode, context *evalContext, target *evalContext) (Derivation, Result, error) {
+	present := context.contains(target.currentResult)(t.value)
+	if err := evalNodeInplace(node, t.state, target); err != nil {
+		return Derivation{}, target.currentResult, err
+	}
+	result := target.currentResult
+
+	d := Derivation{
+		Step:     describeStep(node),
+		Expr:     node.String(),
+		Included: !present && context.contains(result)(t.value),
+	}
+	if context.depth > MaxQueryDepth {
+		return d, result, nil
+	}
+
+	var err error
+	switch n := node.(type) {
+	case nodeOperator:
+		err = t.explainOperator(&d, n, context)
+	case nodeClusterLookup:
+		err = t.explainClusterLookup(&d, n, context)
+	case nodeLocalClusterLookup:
+		cluster := context.currentClusterName
+		if cluster == "" {
+			cluster = t.state.defaultCluster
+		}
+		err = t.explainLookups(&d, []string{cluster}, []string{n.key}, context)
+	case nodeComplement:
+		err = t.explainComplement(&d, n.node, context)
+	case nodeFunction:
+		if strings.ToLower(n.name) == "not" && len(n.params) == 1 {
+			err = t.explainComplement(&d, n.params[0], context)
+		} else if d.Included {
+			err = t.explainIncluded(&d, n.params, context.sub())
+		}
+	}
+	return d, result, err
+}
+
+// explainIncluded adds the nodes whose results include the value.
+func (t *tracer) explainIncluded(d *Derivation, nodes []parserNode, context evalContext) error {
+	for _, node := range nodes {
+		child, _, err := t.explain(node, &context)
+		if err != nil {
+			return err
+		}
+		if child.Included {
+			d.Children = append(d.Children, child)
+		}
+	}
+	return nil
+}
+
+func (t *tracer) explainOperator(d *Derivation, n nodeOperator, context *evalContext) error {
+	if n.op == operatorUnion {
+		if !d.Included {
+			return nil
+		}
+
+		// Both sides are evaluated into the same result, as when evaluating,
+		// so the value comes from the first side that adds it.
+		shared := context.sub()
+		shared.workingResult = context.workingResult
+		for _, side := range []parserNode{n.left, n.right} {
+			child, _, err := t.explainInto(side, context, &shared)
+			if err != nil {
+				return err
+			}
+			if child.Included {
+				d.Children = append(d.Children, child)
+			}
+		}
+		return nil
+	}
+
+	leftContext := context.sub()
+	left, leftResult, err := t.explain(n.left, &leftContext)
+	if err != nil {
+		return err
+	}
+
+	rightContext := context.sub()
+	if n.op != operatorSymmetricDifference {
+		// Regexes filter the left side, as when evaluating.
+		rightContext.workingResult = &leftResult
+	}
+	right, _, err := t.explain(n.right, &rightContext)
+	if err != nil {
+		return err
+	}
+
+	right.Removed = n.op == operatorSubtract && left.Included && right.Included
+	d.Children = append(d.Children, left, right)
+	return nil
+}
+
+func (t *tracer) explainClusterLookup(d *Derivation, n nodeClusterLookup, context *evalContext) error {
+	if !d.Included {
+		return nil
+	}
+
+	clusters, err := t.values(n.node, context)
+	if err != nil {
+		return err
+	}
+	keys, err := t.values(n.key, context)
+	if err != nil {
+		return err
+	}
+	return t.explainLookups(d, clusters, keys, context)
+}
+
+// explainLookups adds the values stored at each key of each cluster that
+// include the value.
+func (t *tracer) explainLookups(d *Derivation, clusters []string, keys []string, context *evalContext) error {
+	state := t.state
+	for _, name := range clusters {
+		cluster, err := state.cluster(state.fold(name))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			key = state.fold(key)
+			for _, value := range cluster[key] {
+				node, err := parseRange(value, state.unicodeIdentifiers)
+				if err != nil {
+					return err
+				}
+
+				valueContext := context.subCluster(name)
+				child, _, err := t.explain(node, &valueContext)
+				if err != nil {
+					return err
+				}
+				if child.Included {
+					child.Expr, child.Cluster, child.Key = value, name, key
+					d.Children = append(d.Children, child)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// explainComplement adds the universe, and what removed the value from it.
+func (t *tracer) explainComplement(d *Derivation, node parserNode, context *evalContext) error {
+	universeContext := context.sub()
+	if err := t.state.universe(&universeContext); err != nil {
+		return err
+	}
+
+	expr := fmt.Sprintf("%%%s:%s", t.state.defaultCluster, t.state.universeKey)
+	if t.state.universeKey == "" {
+		expr = fmt.Sprintf("@{%%%s:KEYS}", t.state.defaultCluster)
+	}
+	universe := Derivation{
+		Step:     "universe",
+		Expr:     expr,
+		Included: context.contains(universeContext.currentResult)(t.value),
+	}
+
+	subContext := context.sub()
+	subContext.workingResult = &universeContext.currentResult
+	child, _, err := t.explain(node, &subContext)
+	if err != nil {
+		return err
+	}
+	child.Removed = universe.Included && child.Included
+
+	d.Children = append(d.Children, universe, child)
+	return nil
+}
+
+// values evaluates a node, such as the cluster names of a lookup, returning
+// its values sorted.
+func (t *tracer) values(node parserNode, context *evalContext) ([]string, error) {
+	subContext := context.sub()
+	if err := evalNodeInplace(node, t.state, &subContext); err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	for x := range subContext.resultIter() {
+		values = append(values, x.(string))
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+func describeStep(node parserNode) string {
+	switch n := node.(type) {
+	case nodeNull:
+		return "empty"
+	case nodeText:
+		if ranges, _, err := parseNumericRanges(n.val); err == nil && len(ranges) > 0 {
+			return "numeric range"
+		}
+		return "value"
+	case nodeConstant:
+		return "constant"
+	case nodeRegexp:
+		return "regex"
+	case nodeLocalClusterLookup:
+		return "key lookup"
+	case nodeClusterLookup:
+		return "cluster lookup"
+	case nodeGroupQuery:
+		return "group query"
+	case nodeComplement:
+		return "complement"
+	case nodeOperator:
+		return fmt.Sprintf("%s (%s)", n.op.describe(), n.op)
+	case nodeBraces:
+		return "brace expansion"
+	case nodeFunction:
+		return "function " + n.name
+	}
+	return "expression"
+}
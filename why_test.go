@@ -0,0 +1,147 @@
+package grange
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	tests := []struct {
+		query    string
+		value    string
+		expected string
+	}{
+		{"%dc1 - %down", "web1", `in: difference (-) %{dc1} - %{down}
+  in: cluster lookup %{dc1}
+    in: numeric range web1..3 from dc1:CLUSTER
+  not in: cluster lookup %{down}`},
+		{"%dc1 - %down", "web2", `not in: difference (-) %{dc1} - %{down}
+  in: cluster lookup %{dc1}
+    in: numeric range web1..3 from dc1:CLUSTER
+  removed by: cluster lookup %{down}
+    in: value web2 from down:CLUSTER`},
+		{"%dc1 - %down", "db1", `not in: difference (-) %{dc1} - %{down}
+  in: cluster lookup %{dc1}
+    in: key lookup $EXTRA from dc1:CLUSTER
+      in: value db1 from dc1:EXTRA
+  removed by: cluster lookup %{down}
+    in: cluster lookup %dc1:EXTRA from down:CLUSTER
+      in: value db1 from dc1:EXTRA`},
+		{"@web", "web3", `in: cluster lookup %{"GROUPS"}:web
+  in: intersection (&) %dc1 & /web/ from GROUPS:web
+    in: cluster lookup %{dc1}
+      in: numeric range web1..3 from dc1:CLUSTER
+    in: regex /web/`},
+		{"%{has(TYPE;redis)}:CLUSTER,x", "web1", `in: union (,) %{has(TYPE;redis)} , x
+  in: cluster lookup %{has(TYPE;redis)}
+    in: numeric range web1..3 from dc1:CLUSTER`},
+		{"!%down", "web3", `in: complement !%{down}
+  in: universe @{%GROUPS:KEYS}
+  not in: cluster lookup %{down}`},
+		{"not(%down)", "web2", `not in: function not not(%{down})
+  in: universe @{%GROUPS:KEYS}
+  removed by: cluster lookup %{down}
+    in: value web2 from down:CLUSTER`},
+		{"nope", "web1", `not in: value nope`},
+	}
+
+	state := whyState()
+	for _, test := range tests {
+		d, err := state.Why(test.query, test.value)
+		if err != nil {
+			t.Errorf("Why(%s, %s) returned error: %s", test.query, test.value, err)
+		} else if d.String() != test.expected {
+			t.Errorf("Why(%s, %s)\n got:\n%s\nwant:\n%s", test.query, test.value, d, test.expected)
+		}
+	}
+}
+
+func TestWhyErrors(t *testing.T) {
+	state := whyState()
+	if _, err := state.Why("%dc1 & & a", "web1"); err == nil {
+		t.Errorf("Expected parse error")
+	}
+	state.AddCluster("bad", Cluster{"CLUSTER": []string{"%dc1 -"}})
+	if _, err := state.Why("%bad", "web1"); err == nil {
+		t.Errorf("Expected error for invalid cluster value")
+	}
+}
+
+// Why includes exactly the values that Query returns, and the sides of each
+// operator that it follows agree with how the operator combines them.
+func TestWhyAgreesWithQuery(t *testing.T) {
+	queries := []string{
+		"%dc1 , %down",
+		"%down , %dc1 , /db/",
+		"%dc1 , $EXTRA",
+		"%dc1 - %down",
+		"%dc1 - /web/ , web2",
+		"%dc1 & %down",
+		"(%dc1 , x) & (/x/ , %down)",
+		"q(WEB1) , %dc1",
+		"%dc1 , q(WEB1)",
+	}
+	values := []string{"web1", "web2", "web3", "WEB1", "db1", "x", "nope"}
+
+	for _, caseInsensitive := range []bool{false, true} {
+		state := whyState()
+		state.SetCaseInsensitive(caseInsensitive)
+
+		for _, query := range queries {
+			result, err := state.Query(query)
+			if err != nil {
+				t.Fatalf("Query(%s) returned error: %s", query, err)
+			}
+
+			for _, value := range values {
+				d, err := state.Why(query, value)
+				if err != nil {
+					t.Fatalf("Why(%s, %s) returned error: %s", query, value, err)
+				}
+
+				expected := result.Contains(value)
+				if caseInsensitive {
+					expected = false
+					for x := range result.Iter() {
+						expected = expected || strings.EqualFold(x.(string), value)
+					}
+				}
+				if d.Included != expected {
+					t.Errorf("Why(%s, %s).Included = %v, but Query returned %v (case insensitive: %v)",
+						query, value, d.Included, result, caseInsensitive)
+				}
+				checkOperatorSides(t, query, value, d)
+			}
+		}
+	}
+}
+
+func checkOperatorSides(t *testing.T, query string, value string, d Derivation) {
+	included := 0
+	for _, child := range d.Children {
+		if child.Included {
+			included++
+		}
+	}
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(d.Step, "union"):
+		// Only the side that added the value, the first to include it.
+		ok = (d.Included && included == 1) || (!d.Included && len(d.Children) == 0)
+	case strings.HasPrefix(d.Step, "difference"):
+		ok = len(d.Children) == 2 &&
+			d.Included == (d.Children[0].Included && !d.Children[1].Included)
+	case strings.HasPrefix(d.Step, "intersection"):
+		ok = len(d.Children) == 2 &&
+			d.Included == (d.Children[0].Included && d.Children[1].Included)
+	default:
+		return
+	}
+	if !ok {
+		t.Errorf("Why(%s, %s) disagrees with its %s:\n%s", query, value, d.Step, d)
+	}
+	for _, child := range d.Children {
+		checkOperatorSides(t, query, value, child)
+	}
+}